@@ -0,0 +1,22 @@
+#!/bin/sh
+# Regenerate the end-of-life lines for the Go and GCC release cycles in advisories.txt, with the
+# dates from https://endoflife.date. The other lines, like the advisories, are kept, and are
+# updated by hand from https://pkg.go.dev/vuln/list and the release notes. Needs curl and jq.
+set -e
+curl -fsSL https://endoflife.date/api/go.json |
+  jq -r 'def v: split(".") | map(tonumber);
+    .[] | select((.eol | type) == "string" and (.cycle | v) >= [1, 20]) | (.cycle | v) as [$major, $minor] |
+    "Go \(.cycle) eol \(.eol) Go \(.cycle) stopped being supported when Go \($major).\($minor + 2) was released"' |
+  sort -V > advisories.go.new
+curl -fsSL https://endoflife.date/api/gcc.json |
+  jq -r '.[] | select((.eol | type) == "string" and (.cycle | tonumber) >= 9) |
+    "GCC \(.cycle) eol \(.eol) the GCC \(.cycle) branch was closed with GCC \(.latest)"' |
+  sort -V > advisories.gcc.new
+# The generated lines replace the lines for single release cycles, where the first of them was
+awk '
+  /^Go [0-9.]+ eol / { if (!goSeen++) while ((getline line < "advisories.go.new") > 0) print line; next }
+  /^GCC [0-9.]+ eol / { if (!gccSeen++) while ((getline line < "advisories.gcc.new") > 0) print line; next }
+  { print }
+' advisories.txt > advisories.txt.new
+rm advisories.go.new advisories.gcc.new
+mv advisories.txt.new advisories.txt
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	arMagic      = "!<arch>\n"
+	arThinMagic  = "!<thin>\n"
+	arHeaderSize = 60
+)
+
+// arMember is a single member of an ar archive (static library)
+type arMember struct {
+	name string
+	// r and size are used for regular archives
+	r    io.ReaderAt
+	size int64
+	// path is used for thin archives, where the members are stored outside of the archive
+	path string
+}
+
+// isArchive checks if the given data starts with the magic bytes of an ar archive
+func isArchive(r io.ReaderAt) bool {
+	magic := make([]byte, len(arMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		// Too short to be an archive
+		return false
+	}
+	return string(magic) == arMagic || string(magic) == arThinMagic
+}
+
+// readArchive returns the members of the ar archive that can be read from r.
+// The symbol table and the long name table are skipped.
+// dir is the directory that relative member paths in thin archives are relative to.
+// If dir is empty, because the archive is not a file, thin archives are not supported.
+func readArchive(r io.ReaderAt, size int64, dir string) ([]arMember, error) {
+	magic := make([]byte, len(arMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		return nil, errors.New("Not an ar archive")
+	}
+	thin := string(magic) == arThinMagic
+	if !thin && string(magic) != arMagic {
+		return nil, errors.New("Not an ar archive")
+	}
+	if thin && dir == "" {
+		return nil, errors.New("thin archives can only be examined as files, since the members are files next to the archive")
+	}
+
+	var (
+		members   []arMember
+		longNames []byte
+		header    = make([]byte, arHeaderSize)
+		offset    = int64(len(arMagic))
+	)
+	for offset+arHeaderSize <= size {
+		if _, err := r.ReadAt(header, offset); err != nil {
+			return nil, err
+		}
+		if string(header[58:60]) != "`\n" {
+			return nil, errors.New("corrupt ar member header at offset " + strconv.FormatInt(offset, 10))
+		}
+		name := strings.TrimRight(string(header[:16]), " ")
+		memberSize, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil || memberSize < 0 {
+			return nil, errors.New("invalid ar member size at offset " + strconv.FormatInt(offset, 10))
+		}
+		dataOffset := offset + arHeaderSize
+
+		// In thin archives, only the symbol table and the long name table are stored in the archive
+		storedSize := memberSize
+		if thin && name != "/" && name != "//" && name != "/SYM64/" {
+			storedSize = 0
+		}
+		if dataOffset+storedSize > size {
+			return nil, errors.New("truncated ar archive")
+		}
+
+		switch {
+		case name == "/" || name == "/SYM64/" || name == "__.SYMDEF" || name == "__.SYMDEF SORTED":
+			// Symbol table
+		case name == "//":
+			// GNU long name table
+			longNames = make([]byte, memberSize)
+			if _, err := r.ReadAt(longNames, dataOffset); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(name, "#1/"):
+			// BSD long name, stored at the start of the member data
+			nameLength, err := strconv.Atoi(name[3:])
+			if err != nil || int64(nameLength) > memberSize {
+				return nil, errors.New("invalid BSD ar member name: " + name)
+			}
+			nameBytes := make([]byte, nameLength)
+			if _, err := r.ReadAt(nameBytes, dataOffset); err != nil {
+				return nil, err
+			}
+			name = string(bytes.TrimRight(nameBytes, "\x00"))
+			if name == "__.SYMDEF" || name == "__.SYMDEF SORTED" {
+				break
+			}
+			dataSize := memberSize - int64(nameLength)
+			members = append(members, arMember{name: name, r: io.NewSectionReader(r, dataOffset+int64(nameLength), dataSize), size: dataSize})
+		default:
+			if strings.HasPrefix(name, "/") && longNames != nil {
+				// GNU long name, the number is an offset into the long name table
+				nameOffset, err := strconv.Atoi(name[1:])
+				if err != nil || nameOffset < 0 || nameOffset >= len(longNames) {
+					return nil, errors.New("invalid GNU ar member name: " + name)
+				}
+				name = string(longNames[nameOffset:])
+				if pos := strings.Index(name, "/\n"); pos != -1 {
+					name = name[:pos]
+				} else if pos := strings.IndexByte(name, '\n'); pos != -1 {
+					name = name[:pos]
+				}
+			} else {
+				name = strings.TrimSuffix(name, "/")
+			}
+			if thin {
+				memberPath := name
+				if !path.IsAbs(memberPath) {
+					memberPath = path.Join(dir, memberPath)
+				}
+				members = append(members, arMember{name: name, path: memberPath, size: memberSize})
+				break
+			}
+			members = append(members, arMember{name: name, r: io.NewSectionReader(r, dataOffset, memberSize), size: memberSize})
+		}
+
+		// Member data is aligned to an even offset
+		offset = dataOffset + storedSize
+		if offset%2 != 0 {
+			offset++
+		}
+	}
+	return members, nil
+}
+
+// examineArchive examines every member of the ar archive that can be read from r.
+// dir is the directory within the root directory that relative member paths in thin
+// archives are relative to, or an empty string if the archive is not a file.
+func examineArchive(e *examination, r io.ReaderAt, size int64, dir string) ([]result, error) {
+	members, err := readArchive(r, size, dir)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]result, 0, len(members))
+	for _, member := range members {
+		res := result{name: member.name}
+		if member.path != "" {
+			if res.detection, res.details, res.err = examineRegularFile(e, member.path); res.err == nil {
+				res.compiler = res.detection.String()
+			}
+		} else if d, err := detectELF(e.ctx, member.r, member.size); err != nil {
+			res.err = err
+		} else {
+			res.compiler, res.detection = d.String(), &d
+			res.details, res.err = examineDetails(e, member.r, member.size, res.compiler)
+		}
+		if err := e.stopped(); err != nil {
+			return results, err
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testAr returns an ar archive with the given magic, and members with the given raw names
+// and data. For thin archives, the data is only stored for the symbol and long name tables.
+func testAr(magic string, members ...string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	for i := 0; i+1 < len(members); i += 2 {
+		name, data := members[i], members[i+1]
+		fmt.Fprintf(&buf, "%-16s%-12s%-6s%-6s%-8s%-10d`\n", name, "0", "0", "0", "644", len(data))
+		if magic == arMagic || name == "/" || name == "//" {
+			buf.WriteString(data)
+			if len(data)%2 != 0 {
+				buf.WriteByte('\n')
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestReadArchive(t *testing.T) {
+	type member struct {
+		name, path, data string
+	}
+	for _, tc := range []struct {
+		name    string
+		archive []byte
+		dir     string
+		want    []member
+		err     string
+	}{
+		{
+			name:    "GNU",
+			archive: testAr(arMagic, "/", "symbols", "//", "a-long-member-name.o/\n", "b.o/", "odd", "/0", "data"),
+			want:    []member{{name: "b.o", data: "odd"}, {name: "a-long-member-name.o", data: "data"}},
+		},
+		{
+			name:    "BSD",
+			archive: testAr(arMagic, "#1/12", "__.SYMDEF\x00\x00\x00symbols", "#1/20", "a-long-member-name.odata", "c.o", "c"),
+			want:    []member{{name: "a-long-member-name.o", data: "data"}, {name: "c.o", data: "c"}},
+		},
+		{
+			name:    "thin",
+			archive: testAr(arThinMagic, "/", "symbols", "//", "sub/a-long-member-name.o/\n/abs/c.o/\n", "/0", "0123456789", "b.o/", "b", "/26", "c"),
+			dir:     "/lib",
+			want:    []member{{name: "sub/a-long-member-name.o", path: "/lib/sub/a-long-member-name.o"}, {name: "b.o", path: "/lib/b.o"}, {name: "/abs/c.o", path: "/abs/c.o"}},
+		},
+		{
+			name:    "thin without a directory",
+			archive: testAr(arThinMagic, "b.o/", "b"),
+			err:     "thin archives can only be examined as files, since the members are files next to the archive",
+		},
+		{
+			name:    "empty",
+			archive: []byte(arMagic),
+		},
+		{
+			name:    "not an archive",
+			archive: []byte("!<arch"),
+			err:     "Not an ar archive",
+		},
+		{
+			name:    "corrupt header",
+			archive: bytes.Replace(testAr(arMagic, "a.o", "a"), []byte("`\n"), []byte("  "), 1),
+			err:     "corrupt ar member header at offset 8",
+		},
+		{
+			name:    "invalid size",
+			archive: bytes.Replace(testAr(arMagic, "a.o", "a"), []byte("1         `"), []byte("-1        `"), 1),
+			err:     "invalid ar member size at offset 8",
+		},
+		{
+			name:    "truncated",
+			archive: testAr(arMagic, "a.o", "abc")[:len(arMagic)+arHeaderSize+2],
+			err:     "truncated ar archive",
+		},
+		{
+			name:    "invalid GNU long name",
+			archive: testAr(arMagic, "//", "a.o/\n", "/99", "a"),
+			err:     "invalid GNU ar member name: /99",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			members, err := readArchive(bytes.NewReader(tc.archive), int64(len(tc.archive)), tc.dir)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("got the error %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []member
+			for _, m := range members {
+				var data []byte
+				if m.r != nil {
+					data = make([]byte, m.size)
+					if _, err := m.r.ReadAt(data, 0); err != nil {
+						t.Fatal(err)
+					}
+				}
+				got = append(got, member{name: m.name, path: m.path, data: string(data)})
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestExamineThinArchive checks that the members of thin archives are looked up within the root directory
+func TestExamineThinArchive(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "lib"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "lib", "a.o"), testELF(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	archive := testAr(arThinMagic, "//", "/lib/a.o/\n", "a.o/", string(testELF()), "missing.o/", "x", "/0", string(testELF()))
+	e := &examination{ctx: context.Background(), root: rootFS{root}}
+	results, err := examineArchive(e, bytes.NewReader(archive), int64(len(archive)), "/lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := resultNames(results)
+	want := []string{"a.o", "missing.o: resolve /lib/missing.o: file does not exist", "/lib/a.o"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
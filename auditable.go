@@ -0,0 +1,89 @@
+package main
+
+import (
+	"compress/zlib"
+	"debug/elf"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/xyproto/cdetect/detect"
+)
+
+// auditableSection is the section that "cargo auditable" embeds the dependency list in
+const auditableSection = ".dep-v0"
+
+// crate is a Rust package that was compiled into an executable, as recorded by "cargo auditable"
+type crate struct {
+	Name         string `json:"name"`
+	Version      string `json:"version"`
+	Source       string `json:"source"`                 // like "crates.io", "git", "local" or "registry"
+	Kind         string `json:"kind,omitempty"`         // "runtime" (the default) or "build"
+	Dependencies []int  `json:"dependencies,omitempty"` // indices into the list of crates
+	Root         bool   `json:"root,omitempty"`         // the crate that the executable was built from
+}
+
+// auditableData is the zlib compressed JSON document in the .dep-v0 section
+type auditableData struct {
+	Packages []crate `json:"packages"`
+}
+
+// readAuditable returns the crates that are listed in the .dep-v0 section of the given ELF file,
+// where r is what the ELF file is read from. If there is no such section, nil is returned.
+func readAuditable(r io.ReaderAt, f *elf.File) ([]crate, error) {
+	sec := f.Section(auditableSection)
+	if sec == nil {
+		return nil, nil
+	}
+	sr, err := detect.OpenSection(r, f, sec)
+	if err != nil {
+		return nil, err
+	}
+	defer sr.Close()
+	zr, err := zlib.NewReader(sr)
+	if err != nil {
+		return nil, errors.New(auditableSection + ": " + err.Error())
+	}
+	defer zr.Close()
+	var data auditableData
+	if err := json.NewDecoder(io.LimitReader(zr, detect.MaxSectionSize)).Decode(&data); err != nil {
+		return nil, errors.New(auditableSection + ": " + err.Error())
+	}
+	for _, c := range data.Packages {
+		for _, dep := range c.Dependencies {
+			if dep < 0 || dep >= len(data.Packages) {
+				return nil, errors.New(auditableSection + ": invalid dependency index")
+			}
+		}
+	}
+	return data.Packages, nil
+}
+
+// rootCrate returns the crate that the executable was built from, or nil
+func rootCrate(crates []crate) *crate {
+	for i := range crates {
+		if crates[i].Root {
+			return &crates[i]
+		}
+	}
+	return nil
+}
+
+// auditableCompiler returns the compiler for an executable that has a "cargo auditable"
+// dependency list, given what was found by the other detectors. Rust executables that
+// are stripped are often only recognized by the GCC version of the linker.
+func auditableCompiler(compiler string) string {
+	if compiler == "" || compiler == "unknown" {
+		return "Rust"
+	}
+	return "Rust (" + compiler + ")"
+}
+
+// crateDependencies returns the names and versions of the crates that the given crate depends on
+func crateDependencies(crates []crate, c *crate) []string {
+	deps := make([]string, 0, len(c.Dependencies))
+	for _, i := range c.Dependencies {
+		deps = append(deps, crates[i].Name+" "+crates[i].Version)
+	}
+	return deps
+}
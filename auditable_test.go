@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+)
+
+// testELFSection returns an ELF file with one section with the given name and contents
+func testELFSection(name string, contents []byte) []byte {
+	headerSize := binary.Size(elf.Header64{})
+	shstrtab := []byte("\x00" + name + "\x00.shstrtab\x00")
+	shoff := headerSize + len(contents) + len(shstrtab)
+	header := elf.Header64{
+		Ident:     [elf.EI_NIDENT]byte{0x7f, 'E', 'L', 'F', byte(elf.ELFCLASS64), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)},
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     uint64(shoff),
+		Ehsize:    uint16(headerSize),
+		Shentsize: uint16(binary.Size(elf.Section64{})),
+		Shnum:     3,
+		Shstrndx:  2,
+	}
+	sections := []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_PROGBITS), Off: uint64(headerSize), Size: uint64(len(contents)), Addralign: 1},
+		{Name: uint32(len(name) + 2), Type: uint32(elf.SHT_STRTAB), Off: uint64(headerSize + len(contents)), Size: uint64(len(shstrtab)), Addralign: 1},
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, header)
+	buf.Write(contents)
+	buf.Write(shstrtab)
+	binary.Write(&buf, binary.LittleEndian, sections)
+	return buf.Bytes()
+}
+
+// testAuditable returns an ELF file with the given JSON document as the "cargo auditable" dependency list
+func testAuditable(document string) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte(document))
+	zw.Close()
+	return testELFSection(auditableSection, buf.Bytes())
+}
+
+func TestReadAuditable(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want string // the root crate and its dependencies, or the error
+	}{
+		{"no section", testELFSection(".rodata", []byte("hello")), ""},
+		{"crates", testAuditable(`{"packages":[
+			{"name":"app","version":"0.1.0","source":"local","dependencies":[1,2],"root":true},
+			{"name":"serde","version":"1.0.188","source":"crates.io"},
+			{"name":"cc","version":"1.0.83","source":"crates.io","kind":"build"}]}`), "app 0.1.0: serde 1.0.188, cc 1.0.83"},
+		{"no root", testAuditable(`{"packages":[{"name":"serde","version":"1.0.188","source":"crates.io"}]}`), "no root"},
+		{"invalid index", testAuditable(`{"packages":[{"name":"app","version":"0.1.0","source":"local","dependencies":[1],"root":true}]}`), ".dep-v0: invalid dependency index"},
+		{"invalid JSON", testAuditable(`{"packages":`), ".dep-v0: unexpected EOF"},
+		{"not zlib", testELFSection(auditableSection, []byte("not compressed")), ".dep-v0: zlib: invalid header"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := bytes.NewReader(tc.data)
+			f, err := elf.NewFile(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			crates, err := readAuditable(r, f)
+			var got string
+			switch root := rootCrate(crates); {
+			case err != nil:
+				got = err.Error()
+			case root != nil:
+				got = root.Name + " " + root.Version + ": "
+				for i, dep := range crateDependencies(crates, root) {
+					if i > 0 {
+						got += ", "
+					}
+					got += dep
+				}
+			case crates != nil:
+				got = "no root"
+			}
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAuditableCompiler(t *testing.T) {
+	for compiler, want := range map[string]string{
+		"":           "Rust",
+		"unknown":    "Rust",
+		"GCC 13.2.1": "Rust (GCC 13.2.1)",
+	} {
+		if got := auditableCompiler(compiler); got != want {
+			t.Errorf("auditableCompiler(%q) = %q, want %q", compiler, got, want)
+		}
+	}
+}
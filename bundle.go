@@ -0,0 +1,123 @@
+package main
+
+import (
+	"archive/zip"
+	"debug/elf"
+	"errors"
+	"io"
+)
+
+const (
+	zipMagic      = "PK\x03\x04"
+	appImageMagic = "AI\x02"
+
+	// maxDepth is how deeply archives may be nested within archives, for
+	// example a .so file in a .jar file in an .aar file in a .tar.gz file
+	maxDepth = 8
+)
+
+// isZip checks if the given data starts with the magic bytes of a ZIP archive.
+// Java archives (.jar), Python wheels (.whl) and Android packages (.apk and .aar) are ZIP archives.
+func isZip(r io.ReaderAt) bool {
+	magic := make([]byte, len(zipMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		return false
+	}
+	return string(magic) == zipMagic
+}
+
+// examineZip examines every ELF file in the ZIP archive that can be read from r,
+// including the ELF files in nested archives
+func examineZip(e *examination, r io.ReaderAt, size int64, depth int) ([]result, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	var results []result
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			results = append(results, result{name: packagePath(f.Name), err: err})
+			continue
+		}
+		memberResults, err := examinePackageFile(e, packagePath(f.Name), rc, int64(f.UncompressedSize64), depth+1)
+		rc.Close()
+		results = append(results, memberResults...)
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// isAppImage checks if the given ELF file is a type 2 AppImage, which is an ELF
+// runtime with a SquashFS image appended to it
+func isAppImage(r io.ReaderAt) bool {
+	ident := make([]byte, 11)
+	if _, err := r.ReadAt(ident, 0); err != nil {
+		return false
+	}
+	return string(ident[:4]) == string(elfMagic) && string(ident[8:11]) == appImageMagic
+}
+
+// appImageOffset returns where the SquashFS payload of an AppImage starts, which is right
+// after the section header table at the end of the ELF runtime
+func appImageOffset(r io.ReaderAt, f *elf.File) (int64, error) {
+	header := make([]byte, 64)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return 0, err
+	}
+	switch f.Class {
+	case elf.ELFCLASS32:
+		shoff := int64(f.ByteOrder.Uint32(header[0x20:]))
+		shentsize := int64(f.ByteOrder.Uint16(header[0x2e:]))
+		shnum := int64(f.ByteOrder.Uint16(header[0x30:]))
+		return shoff + shentsize*shnum, nil
+	case elf.ELFCLASS64:
+		shoff := int64(f.ByteOrder.Uint64(header[0x28:]))
+		shentsize := int64(f.ByteOrder.Uint16(header[0x3a:]))
+		shnum := int64(f.ByteOrder.Uint16(header[0x3c:]))
+		return shoff + shentsize*shnum, nil
+	}
+	return 0, errors.New("unknown ELF class")
+}
+
+// examineAppImage examines every ELF file in the SquashFS payload of an AppImage
+func examineAppImage(e *examination, r io.ReaderAt, size int64, depth int) ([]result, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := appImageOffset(r, f)
+	if err != nil {
+		return nil, err
+	}
+	if offset <= 0 || offset >= size {
+		return nil, errors.New("could not find the SquashFS payload of the AppImage")
+	}
+	payload := io.NewSectionReader(r, offset, size-offset)
+	if !isSquashfs(payload) {
+		return nil, errors.New("could not find the SquashFS payload of the AppImage")
+	}
+	return examineSquashfs(e, payload, size-offset, depth)
+}
+
+// examineSquashfs examines every ELF file in the SquashFS image that can be read from r,
+// including the ELF files in nested archives
+func examineSquashfs(e *examination, r io.ReaderAt, size int64, depth int) ([]result, error) {
+	fs, err := openSquashfs(r, size)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.close()
+	var results []result
+	err = fs.walk(func(name string, fr io.Reader, fileSize int64) error {
+		memberResults, err := examinePackageFile(e, name, fr, fileSize, depth+1)
+		results = append(results, memberResults...)
+		return err
+	})
+	return results, err
+}
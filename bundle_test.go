@@ -0,0 +1,115 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"debug/elf"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// testZip returns a ZIP archive with the given files, in order. Names that end with a slash are directories.
+func testZip(t testing.TB, files ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i+1 < len(files); i += 2 {
+		w, err := zw.Create(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(files[i+1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testAppImage returns a type 2 AppImage with the given payload, with an ELF runtime
+// that only has a header, followed by a section header table with the null section
+func testAppImage(payload []byte) []byte {
+	header := elf.Header64{
+		Ident:     [elf.EI_NIDENT]byte{0x7f, 'E', 'L', 'F', byte(elf.ELFCLASS64), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT), 0, 'A', 'I', 2},
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     64,
+		Ehsize:    64,
+		Shentsize: 64,
+		Shnum:     1,
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, header)
+	binary.Write(&buf, binary.LittleEndian, elf.Section64{})
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+func TestExamineBundles(t *testing.T) {
+	exe := string(testELF())
+	jar := testZip(t, "META-INF/MANIFEST.MF", "Manifest-Version: 1.0\n", "lib/x86_64/libx.so", exe)
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want []string
+		err  string
+	}{
+		{
+			name: "wheel",
+			data: testZip(t, "x/", "", "x/__init__.py", "", "x/_x.cpython-312-x86_64-linux-gnu.so", exe, "x.libs/libgfortran.so.5", exe),
+			want: []string{"/x/_x.cpython-312-x86_64-linux-gnu.so", "/x.libs/libgfortran.so.5"},
+		},
+		{
+			name: "Android library with a nested JAR",
+			data: testZip(t, "classes.jar", string(jar), "jni/arm64-v8a/liby.so", exe),
+			want: []string{"/classes.jar(/lib/x86_64/libx.so)", "/jni/arm64-v8a/liby.so"},
+		},
+		{
+			name: "too deeply nested",
+			data: nestTestZip(t, jar, maxDepth+1),
+			want: []string{"/a.zip(/a.zip(/a.zip(/a.zip(/a.zip(/a.zip(/a.zip(/a.zip(/a.zip)))))))): archives are nested too deeply"},
+		},
+		{
+			name: "AppImage",
+			data: testAppImage(testSquashfs(map[string]string{"/usr/bin/app": exe, "/AppRun": "#!/bin/sh\n"}, nil, false)),
+			want: []string{"/usr/bin/app"},
+		},
+		{
+			name: "AppImage without a payload",
+			data: testAppImage(nil),
+			err:  "could not find the SquashFS payload of the AppImage",
+		},
+		{
+			name: "AppImage with another payload",
+			data: testAppImage(jar),
+			err:  "could not find the SquashFS payload of the AppImage",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := examineBytes(&examination{ctx: context.Background()}, tc.data)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("got the error %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resultNames(results); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// nestTestZip returns the given ZIP archive, nested within the given number of ZIP archives
+func nestTestZip(t testing.TB, data []byte, n int) []byte {
+	for i := 0; i < n; i++ {
+		data = testZip(t, "a.zip", string(data))
+	}
+	return data
+}
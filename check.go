@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// advisoriesData is the embedded list of compilers and compiler versions with known problems
+//
+//go:embed advisories.txt
+var advisoriesData string
+
+// The levels of findings, as in SARIF
+const (
+	levelError   = "error"
+	levelWarning = "warning"
+	levelNote    = "note"
+)
+
+// finding is a problem with an examined file, like an end-of-life compiler or a policy violation
+type finding struct {
+	rule    string // the kind of finding, like "eol", "advisory" or "policy"
+	id      string // like an advisory ID, or the name of a policy rule
+	level   string // levelError, levelWarning or levelNote
+	message string
+}
+
+// String returns the level and the message of the finding
+func (fi *finding) String() string {
+	return fi.level + ": " + fi.message
+}
+
+// advisory is a compiler and a range of compiler versions with a known problem
+type advisory struct {
+	compiler    string
+	versions    []versionConstraint
+	kind        string // "eol" or "advisory"
+	reference   string // the end-of-life date, or the advisory ID
+	description string
+}
+
+// parseAdvisories parses the advisories that can be read from r, one per line.
+// Empty lines and comments are skipped. source is used in error messages.
+func parseAdvisories(r io.Reader, source string) ([]advisory, error) {
+	var advisories []advisory
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		where := source + ":" + strconv.Itoa(lineNumber)
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			return nil, errors.New(where + ": expected a compiler, versions, a kind, a reference and a description")
+		}
+		versions, err := parseConstraints(fields[1])
+		if err != nil {
+			return nil, errors.New(where + ": " + err.Error())
+		}
+		switch fields[2] {
+		case "eol":
+			if _, err := time.Parse(time.DateOnly, fields[3]); err != nil {
+				return nil, errors.New(where + ": invalid date: " + fields[3])
+			}
+		case "advisory":
+		default:
+			return nil, errors.New(where + ": unknown kind: " + fields[2])
+		}
+		advisories = append(advisories, advisory{
+			compiler:    fields[0],
+			versions:    versions,
+			kind:        fields[2],
+			reference:   fields[3],
+			description: strings.Join(fields[4:], " "),
+		})
+	}
+	return advisories, scanner.Err()
+}
+
+// loadAdvisories returns the embedded advisories, and the ones in
+// ~/.config/cdetect/advisories.txt, if it exists
+func loadAdvisories() ([]advisory, error) {
+	advisories, err := parseAdvisories(strings.NewReader(advisoriesData), "advisories.txt")
+	if err != nil {
+		return nil, err
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return advisories, nil
+	}
+	filename := filepath.Join(configDir, "cdetect", "advisories.txt")
+	f, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return advisories, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	userAdvisories, err := parseAdvisories(f, filename)
+	if err != nil {
+		return nil, err
+	}
+	return append(advisories, userAdvisories...), nil
+}
+
+// checkCompiler returns the advisories that apply to the given compiler, like "Go 1.21.3",
+// as findings. End-of-life dates that are after now are not included.
+func checkCompiler(compiler string, advisories []advisory, now time.Time) []finding {
+	t := parseTool(compiler)
+	if t.version == "" {
+		return nil
+	}
+	var findings []finding
+	for _, a := range advisories {
+		if !strings.EqualFold(a.compiler, t.name) || !matchesAll(a.versions, t.version) {
+			continue
+		}
+		switch a.kind {
+		case "eol":
+			if date, _ := time.Parse(time.DateOnly, a.reference); date.After(now) {
+				continue
+			}
+			findings = append(findings, finding{
+				rule:    "eol",
+				id:      "eol",
+				level:   levelWarning,
+				message: compiler + " is end-of-life since " + a.reference + ": " + a.description,
+			})
+		case "advisory":
+			findings = append(findings, finding{
+				rule:    "advisory",
+				id:      a.reference,
+				level:   levelError,
+				message: a.reference + ": " + a.description + " (" + compiler + ")",
+			})
+		}
+	}
+	return findings
+}
+
+// checkResults adds findings to the given results, for the compilers that have known problems,
+// and returns the number of findings
+func checkResults(results []result, advisories []advisory) int {
+	now := time.Now()
+	count := 0
+	for i := range results {
+		res := &results[i]
+		if res.err != nil {
+			continue
+		}
+		findings := checkCompiler(res.compiler, advisories, now)
+		res.findings = append(res.findings, findings...)
+		count += len(findings)
+	}
+	return count
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAdvisories(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		err  string
+	}{
+		{"# comment\n\nGo 1.20 eol 2024-02-06 no longer supported\nGCC <4.9 advisory CVE-0000-0001 a description\n", ""},
+		{"Go 1.20 eol 2024-02-06", "test:1: expected a compiler, versions, a kind, a reference and a description"},
+		{"\nGo x eol 2024-02-06 no longer supported", "test:2: invalid version: x"},
+		{"Go 1.20 eol 2024-02-30 no longer supported", "test:1: invalid date: 2024-02-30"},
+		{"Go 1.20 deprecated 2024-02-06 no longer supported", "test:1: unknown kind: deprecated"},
+	} {
+		_, err := parseAdvisories(strings.NewReader(tc.text), "test")
+		if tc.err == "" && err != nil {
+			t.Errorf("%q: %v", tc.text, err)
+		}
+		if tc.err != "" && (err == nil || err.Error() != tc.err) {
+			t.Errorf("%q: got the error %v, want %q", tc.text, err, tc.err)
+		}
+	}
+}
+
+// TestEmbeddedAdvisories checks that the advisories that are embedded in the executable can be parsed
+func TestEmbeddedAdvisories(t *testing.T) {
+	advisories, err := parseAdvisories(strings.NewReader(advisoriesData), "advisories.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(advisories) == 0 {
+		t.Error("no advisories in advisories.txt")
+	}
+}
+
+func TestCheckCompiler(t *testing.T) {
+	advisories, err := parseAdvisories(strings.NewReader(`
+Go <1.20 eol 2024-02-06 Go 1.19 and earlier are no longer supported
+Go 1.30 eol 2099-01-01 Go 1.30 stops being supported
+go >=1.21.0,<1.21.3 advisory CVE-2023-39325 rapid reset
+GCC <13.3 advisory CVE-0000-0002 an advisory for GCC
+`), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		compiler string
+		want     []string
+	}{
+		{"Go 1.19.13", []string{"warning: Go 1.19.13 is end-of-life since 2024-02-06: Go 1.19 and earlier are no longer supported"}},
+		{"Go 1.21.1", []string{"error: CVE-2023-39325: rapid reset (Go 1.21.1)"}},
+		{"Go 1.21.3", nil},
+		{"Go 1.30.1", nil},
+		{"GCC 13.2.1", []string{"error: CVE-0000-0002: an advisory for GCC (GCC 13.2.1)"}},
+		{"Rust 1.75.0 (GCC 13.2.1)", nil},
+		{"GCC", nil},
+		{"unknown", nil},
+	} {
+		var got []string
+		for _, fi := range checkCompiler(tc.compiler, advisories, now) {
+			got = append(got, fi.String())
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.compiler, got, tc.want)
+		}
+	}
+	results := []result{{compiler: "Go 1.19.13"}, {compiler: "Go 1.21.1", err: errTooLarge}, {compiler: "GCC 12.2.0"}}
+	if n := checkResults(results, advisories); n != 2 || len(results[0].findings) != 1 || len(results[1].findings) != 0 || len(results[2].findings) != 1 {
+		t.Errorf("got %d findings: %+v", n, results)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/xyproto/ainur"
+	"github.com/xyproto/cdetect/detect"
+)
+
+const (
+	ntFile          = 0x46494c45 // "FILE", the files that were mapped into memory
+	ntPrpsinfo      = 3          // process information, including the command name
+	goBuildInfo     = "\xff Go buildinf:"
+	deletedSuffix   = " (deleted)"
+	prpsinfoFname32 = 28 // offset of pr_fname in the 32-bit prpsinfo struct
+	prpsinfoFname64 = 40 // offset of pr_fname in the 64-bit prpsinfo struct
+	fnameSize       = 16
+)
+
+var (
+	// rustcCommitRegex matches the paths to the Rust standard library source, which
+	// include the commit hash of the compiler, for example in panic location strings
+	rustcCommitRegex = regexp.MustCompile(`/rustc/([0-9a-f]{40})/`)
+
+	// clangVersionRegex matches a Clang version string
+	clangVersionRegex = regexp.MustCompile(`clang version (\d+\.\d+(\.\d+)?)`)
+)
+
+// mappedFile is a file that was mapped into the memory of a process, according to a core dump
+type mappedFile struct {
+	name   string
+	ranges [][2]uint64 // the start and end addresses of the mappings
+}
+
+// coreNote is a note from a PT_NOTE segment
+type coreNote struct {
+	kind uint32
+	name string
+	desc []byte
+}
+
+// isCore checks if the data that can be read from r is an ELF core dump
+func isCore(r io.ReaderAt) bool {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return false
+	}
+	return f.Type == elf.ET_CORE
+}
+
+// readNotes reads all notes in the PT_NOTE segments of the given ELF file
+func readNotes(f *elf.File) ([]coreNote, error) {
+	var notes []coreNote
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_NOTE {
+			continue
+		}
+		if prog.Filesz > maxDecompressedSize {
+			return nil, errors.New("the PT_NOTE segment is too large")
+		}
+		data, err := io.ReadAll(prog.Open())
+		if err != nil {
+			return nil, err
+		}
+		for len(data) >= 12 {
+			nameSize := uint64(f.ByteOrder.Uint32(data))
+			descSize := uint64(f.ByteOrder.Uint32(data[4:]))
+			kind := f.ByteOrder.Uint32(data[8:])
+			data = data[12:]
+			// The name and the description are padded to 4 bytes
+			nameEnd := (nameSize + 3) &^ 3
+			descEnd := nameEnd + (descSize+3)&^3
+			if descEnd > uint64(len(data)) {
+				return nil, errors.New("truncated note")
+			}
+			notes = append(notes, coreNote{
+				kind: kind,
+				name: strings.TrimRight(string(data[:nameSize]), "\x00"),
+				desc: data[nameEnd : nameEnd+descSize],
+			})
+			data = data[descEnd:]
+		}
+	}
+	return notes, nil
+}
+
+// parseFileNote parses the NT_FILE note, which lists the files that were mapped
+// into memory, ordered by address. The executable is usually mapped first.
+func parseFileNote(f *elf.File, desc []byte) ([]*mappedFile, error) {
+	wordSize := 8
+	word := func(b []byte) uint64 { return f.ByteOrder.Uint64(b) }
+	if f.Class == elf.ELFCLASS32 {
+		wordSize = 4
+		word = func(b []byte) uint64 { return uint64(f.ByteOrder.Uint32(b)) }
+	}
+	if len(desc) < 2*wordSize {
+		return nil, errors.New("truncated NT_FILE note")
+	}
+	count := word(desc)
+	// Skip the count and the page size
+	desc = desc[2*wordSize:]
+	if count > uint64(len(desc)/(3*wordSize)) {
+		return nil, errors.New("corrupt NT_FILE note")
+	}
+	names := bytes.Split(desc[count*3*uint64(wordSize):], []byte{0})
+	if uint64(len(names)) < count {
+		return nil, errors.New("corrupt NT_FILE note")
+	}
+	var (
+		files  []*mappedFile
+		byName = make(map[string]*mappedFile)
+	)
+	for i := uint64(0); i < count; i++ {
+		entry := desc[i*3*uint64(wordSize):]
+		start, end := word(entry), word(entry[wordSize:])
+		name := string(names[i])
+		mf, ok := byName[name]
+		if !ok {
+			mf = &mappedFile{name: name}
+			byName[name] = mf
+			files = append(files, mf)
+		}
+		mf.ranges = append(mf.ranges, [2]uint64{start, end})
+	}
+	return files, nil
+}
+
+// parseCommandName returns the command name (pr_fname) from the NT_PRPSINFO note
+func parseCommandName(f *elf.File, desc []byte) string {
+	offset := prpsinfoFname64
+	if f.Class == elf.ELFCLASS32 {
+		offset = prpsinfoFname32
+	}
+	if len(desc) < offset+fnameSize {
+		return ""
+	}
+	return string(bytes.TrimRight(desc[offset:offset+fnameSize], "\x00"))
+}
+
+// goVersionFromBuildInfo returns the Go version from the build information
+// blob that Go 1.18 and later embeds in executables, or an empty string
+func goVersionFromBuildInfo(b []byte) string {
+	pos := bytes.Index(b, []byte(goBuildInfo))
+	if pos == -1 || len(b) < pos+33 {
+		return ""
+	}
+	b = b[pos:]
+	// If the flags have bit 2 set, the version string is stored inline, with the length as a varint
+	if b[15]&2 == 0 {
+		return ""
+	}
+	length, n := binary.Uvarint(b[32:])
+	if n <= 0 || uint64(len(b)) < 32+uint64(n)+length {
+		return ""
+	}
+	version := string(b[32+n : 32+uint64(n)+length])
+	if !strings.HasPrefix(version, "go") {
+		return ""
+	}
+	return "Go " + strings.TrimPrefix(version, "go")
+}
+
+// scanMemory searches the data that can be read from r for compiler version
+// markers that are present in memory, and returns the compiler or an empty string.
+// The search stops when the context is done.
+func scanMemory(ctx context.Context, r io.Reader) (string, error) {
+	bufferSize := 8192
+	sr, err := detect.NewStreamReader(ctx, r, bufferSize)
+	if err != nil {
+		return "", err
+	}
+	for {
+		b, err := sr.Next()
+		if err == io.EOF {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if goVersion := goVersionFromBuildInfo(b); goVersion != "" {
+			return goVersion, nil
+		}
+		if m := rustcCommitRegex.FindSubmatch(b); m != nil {
+			return rustcVersion(string(m[1])), nil
+		}
+		if m := clangVersionRegex.FindSubmatch(b); m != nil {
+			return "Clang " + string(m[1]), nil
+		}
+		if pos := bytes.Index(b, []byte("GCC: (")); pos != -1 {
+			if m := ainur.GCCVersionRegex1.Find(b[pos:]); m != nil {
+				return "GCC " + strings.TrimSpace(string(m[2:])), nil
+			}
+		}
+	}
+}
+
+// scanMappedMemory searches the memory of the given mapped file, as dumped in the
+// PT_LOAD segments of the core dump, for compiler version markers
+func scanMappedMemory(ctx context.Context, f *elf.File, mf *mappedFile) (string, error) {
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_LOAD || prog.Filesz == 0 {
+			continue
+		}
+		for _, rng := range mf.ranges {
+			if prog.Vaddr < rng[0] || prog.Vaddr >= rng[1] {
+				continue
+			}
+			compiler, err := scanMemory(ctx, prog.Open())
+			if err != nil {
+				return "", err
+			}
+			if compiler != "" {
+				return compiler, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// examineCore lists the executable and the libraries that were mapped into the memory of the
+// crashed process, and examines them if they can still be found on disk. If not, the memory of
+// the mapped files is searched for compiler version markers. The results are grouped by the
+// command name of the process, and the main executable comes first. The mapped files are only
+// looked up, within the root directory, if local is true. Core dumps that are not files, like
+// uploads, may name any file on the host.
+func examineCore(e *examination, r io.ReaderAt, local bool) ([]result, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	notes, err := readNotes(f)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		files   []*mappedFile
+		command string
+	)
+	for _, note := range notes {
+		if note.name != "CORE" {
+			continue
+		}
+		switch note.kind {
+		case ntFile:
+			if files, err = parseFileNote(f, note.desc); err != nil {
+				return nil, err
+			}
+		case ntPrpsinfo:
+			command = parseCommandName(f, note.desc)
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.New("the core dump has no NT_FILE note")
+	}
+	// The main executable is the first mapped file with a name that matches the
+	// command name, which is truncated to 15 characters
+	for i, mf := range files {
+		base := path.Base(strings.TrimSuffix(mf.name, deletedSuffix))
+		if command != "" && strings.HasPrefix(base, command) {
+			files[0], files[i] = files[i], files[0]
+			break
+		}
+	}
+	if command == "" {
+		command = path.Base(strings.TrimSuffix(files[0].name, deletedSuffix))
+	}
+	results := make([]result, 0, len(files))
+	for _, mf := range files {
+		if err := e.stopped(); err != nil {
+			return results, err
+		}
+		res := result{name: strings.TrimSuffix(mf.name, deletedSuffix), group: command}
+		if local && !strings.HasSuffix(mf.name, deletedSuffix) && e.root.exists(mf.name) {
+			if res.detection, res.details, res.err = examineRegularFile(e, mf.name); res.err == nil {
+				res.compiler = res.detection.String()
+			}
+			if err := e.stopped(); err != nil {
+				return results, err
+			}
+			results = append(results, res)
+			continue
+		}
+		// The file is gone, or is not looked up, so search the memory that was dumped instead
+		compiler, err := scanMappedMemory(e.ctx, f, mf)
+		if stopped := e.stopped(); stopped != nil {
+			return results, stopped
+		}
+		switch {
+		case err != nil:
+			res.err = err
+		case compiler != "":
+			res.compiler = compiler
+		case !local:
+			res.err = errors.New("the file is only looked up for core dumps on disk, and no compiler version markers were found in memory")
+		default:
+			res.err = errors.New("the file is gone, and no compiler version markers were found in memory")
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testFileNote returns the description of an NT_FILE note for a 64-bit little endian core dump
+// with the given mappings, as the start address, the end address and the name of each one
+func testFileNote(mappings ...interface{}) []byte {
+	var (
+		buf   bytes.Buffer
+		names []byte
+	)
+	binary.Write(&buf, binary.LittleEndian, []uint64{uint64(len(mappings) / 3), 4096})
+	for i := 0; i+2 < len(mappings); i += 3 {
+		binary.Write(&buf, binary.LittleEndian, []uint64{uint64(mappings[i].(int)), uint64(mappings[i+1].(int)), 0})
+		names = append(names, mappings[i+2].(string)+"\x00"...)
+	}
+	return append(buf.Bytes(), names...)
+}
+
+func TestParseFileNote(t *testing.T) {
+	f64 := &elf.File{FileHeader: elf.FileHeader{Class: elf.ELFCLASS64, ByteOrder: binary.LittleEndian}}
+	f32 := &elf.File{FileHeader: elf.FileHeader{Class: elf.ELFCLASS32, ByteOrder: binary.BigEndian}}
+	note32 := []byte{0, 0, 0, 1, 0, 0, 0x10, 0, 0, 0, 0x20, 0, 0, 0, 0x30, 0, 0, 0, 0, 0}
+	note32 = append(note32, "/bin/sh\x00"...)
+	for _, tc := range []struct {
+		name string
+		f    *elf.File
+		desc []byte
+		want []*mappedFile
+		err  string
+	}{
+		{
+			name: "64-bit",
+			f:    f64,
+			desc: testFileNote(0x1000, 0x2000, "/usr/bin/app", 0x2000, 0x3000, "/usr/bin/app", 0x7000, 0x8000, "/usr/lib/libc.so.6 (deleted)"),
+			want: []*mappedFile{
+				{name: "/usr/bin/app", ranges: [][2]uint64{{0x1000, 0x2000}, {0x2000, 0x3000}}},
+				{name: "/usr/lib/libc.so.6 (deleted)", ranges: [][2]uint64{{0x7000, 0x8000}}},
+			},
+		},
+		{
+			name: "32-bit",
+			f:    f32,
+			desc: note32,
+			want: []*mappedFile{{name: "/bin/sh", ranges: [][2]uint64{{0x2000, 0x3000}}}},
+		},
+		{
+			name: "empty",
+			f:    f64,
+			desc: testFileNote(),
+		},
+		{
+			name: "truncated",
+			f:    f64,
+			desc: make([]byte, 15),
+			err:  "truncated NT_FILE note",
+		},
+		{
+			name: "count too large",
+			f:    f64,
+			desc: testFileNote(0x1000, 0x2000, "/usr/bin/app")[:16+24-1],
+			err:  "corrupt NT_FILE note",
+		},
+		{
+			name: "missing names",
+			f:    f64,
+			desc: append(testFileNote(0x1000, 0x2000, "a", 0x2000, 0x3000, "b")[:16+2*24], 'a'),
+			err:  "corrupt NT_FILE note",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseFileNote(tc.f, tc.desc)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("got the error %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+// testGoBuildInfo returns the build information blob of Go 1.18 and later, with the given version
+func testGoBuildInfo(version string) []byte {
+	b := make([]byte, 32)
+	copy(b, goBuildInfo)
+	b[14], b[15] = 8, 2
+	b = binary.AppendUvarint(b, uint64(len(version)))
+	return append(b, version...)
+}
+
+func TestScanMemory(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		memory []byte
+		want   string
+	}{
+		{"Go", append([]byte("padding"), testGoBuildInfo("go1.22.1")...), "Go 1.22.1"},
+		{"Go without an inline version", append(testGoBuildInfo("go1.22.1")[:15], make([]byte, 32)...), ""},
+		{"not Go", testGoBuildInfo("1.22.1"), ""},
+		{"Rust", []byte("\x00/rustc/82e1608dfa6e0b5569232559e3d385fea5a93112/library/core/src/panicking.rs\x00"), "Rust 1.75.0"},
+		{"Clang", []byte("\x00clang version 17.0.6 (Fedora 17.0.6-2.fc39)\x00"), "Clang 17.0.6"},
+		{"GCC", []byte("\x00GCC: (GNU) 13.2.1 20230801\x00"), "GCC 13.2.1"},
+		{"far into the memory", append(make([]byte, 100000), "GCC: (GNU) 12.2.0 20221121\x00"...), "GCC 12.2.0"},
+		{"nothing", make([]byte, 10000), ""},
+	} {
+		got, err := scanMemory(context.Background(), bytes.NewReader(tc.memory))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// testCore returns a 64-bit little endian core dump of the process with the given command name,
+// with the given NT_FILE note, if any, and with the given memory dumped at the given address
+func testCore(command string, fileNote []byte, address uint64, memory []byte) []byte {
+	le := binary.LittleEndian
+	var notes bytes.Buffer
+	writeNote := func(kind uint32, desc []byte) {
+		binary.Write(&notes, le, []uint32{5, uint32(len(desc)), kind})
+		notes.WriteString("CORE\x00\x00\x00\x00")
+		notes.Write(desc)
+		for notes.Len()%4 != 0 {
+			notes.WriteByte(0)
+		}
+	}
+	prpsinfo := make([]byte, 136)
+	copy(prpsinfo[prpsinfoFname64:], command)
+	writeNote(ntPrpsinfo, prpsinfo)
+	if fileNote != nil {
+		writeNote(ntFile, fileNote)
+	}
+
+	const headersSize = 64 + 2*56
+	var buf bytes.Buffer
+	binary.Write(&buf, le, elf.Header64{
+		Ident:     [elf.EI_NIDENT]byte{0x7f, 'E', 'L', 'F', byte(elf.ELFCLASS64), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)},
+		Type:      uint16(elf.ET_CORE),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     64,
+		Ehsize:    64,
+		Phentsize: 56,
+		Phnum:     2,
+	})
+	binary.Write(&buf, le, elf.Prog64{Type: uint32(elf.PT_NOTE), Off: headersSize, Filesz: uint64(notes.Len())})
+	binary.Write(&buf, le, elf.Prog64{Type: uint32(elf.PT_LOAD), Off: headersSize + uint64(notes.Len()), Vaddr: address, Filesz: uint64(len(memory)), Memsz: uint64(len(memory))})
+	buf.Write(notes.Bytes())
+	buf.Write(memory)
+	return buf.Bytes()
+}
+
+func TestExamineCore(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "usr", "lib"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "usr", "lib", "libx.so"), testELF(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	core := testCore("a-very-long-com", testFileNote(
+		0x1000, 0x2000, "/usr/lib/libx.so",
+		0x2000, 0x3000, "/usr/lib/libgone.so (deleted)",
+		0x4000, 0x5000, "/usr/bin/a-very-long-command",
+	), 0x2000, []byte("\x00GCC: (GNU) 13.2.1 20230801\x00"))
+	for _, tc := range []struct {
+		name  string
+		local bool
+		want  []string
+	}{
+		{"on disk", true, []string{
+			"/usr/bin/a-very-long-command: the file is gone, and no compiler version markers were found in memory",
+			"/usr/lib/libgone.so",
+			"/usr/lib/libx.so",
+		}},
+		{"uploaded", false, []string{
+			"/usr/bin/a-very-long-command: the file is only looked up for core dumps on disk, and no compiler version markers were found in memory",
+			"/usr/lib/libgone.so",
+			"/usr/lib/libx.so: the file is only looked up for core dumps on disk, and no compiler version markers were found in memory",
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			e := &examination{ctx: context.Background(), root: rootFS{root}}
+			results, err := examineCore(e, bytes.NewReader(core), tc.local)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resultNames(results); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+			for _, res := range results {
+				if res.group != "a-very-long-com" {
+					t.Errorf("%s: got the group %q", res.name, res.group)
+				}
+				if res.name == "/usr/lib/libgone.so" && res.compiler != "GCC 13.2.1" {
+					t.Errorf("%s: got %q from the memory, want %q", res.name, res.compiler, "GCC 13.2.1")
+				}
+			}
+		})
+	}
+	if _, err := examineCore(&examination{ctx: context.Background()}, bytes.NewReader(testCore("x", nil, 0, nil)), false); err == nil || err.Error() != "the core dump has no NT_FILE note" {
+		t.Errorf("got the error %v for a core dump without mapped files", err)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/xi2/xz"
+)
+
+// maxDecompressedSize is the largest size a compressed file is allowed to decompress to,
+// and how much data an examination may hold in memory, at all nesting levels together
+const maxDecompressedSize = 1024 * 1024 * 1024
+
+// errTooLarge is returned for data that is too large to be examined
+var errTooLarge = errors.New("too large to be examined")
+
+// compression is a compression format that can be recognized by its magic bytes
+type compression struct {
+	name   string
+	magic  []byte
+	reader func(io.Reader) (io.ReadCloser, error)
+}
+
+// compressions is a slice of the supported compression formats
+var compressions = []compression{
+	{"gzip", []byte{0x1f, 0x8b}, func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	}},
+	{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, func(r io.Reader) (io.ReadCloser, error) {
+		// xi2/xz also supports the BCJ filters that are used when compressing kernel images
+		xr, err := xz.NewReader(r, 0)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xr), nil
+	}},
+	{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd}, func(r io.Reader) (io.ReadCloser, error) {
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}},
+	{"lz4", []byte{0x04, 0x22, 0x4d, 0x18}, func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(lz4.NewReader(r)), nil
+	}},
+	// The legacy LZ4 frame format is used for compressing kernel images
+	{"lz4", []byte{0x02, 0x21, 0x4c, 0x18}, func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(lz4.NewReader(r)), nil
+	}},
+	{"bzip2", []byte("BZh"), func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	}},
+}
+
+// detectCompression returns the compression format that the given data starts with,
+// or nil if no supported compression format is recognized.
+func detectCompression(header []byte) *compression {
+	for i := range compressions {
+		if bytes.HasPrefix(header, compressions[i].magic) {
+			return &compressions[i]
+		}
+	}
+	return nil
+}
+
+// indexCompression returns the position and format of the first compressed
+// stream that can be found in the given data, or -1 and nil.
+func indexCompression(data []byte) (int, *compression) {
+	bestPos := -1
+	var best *compression
+	for i := range compressions {
+		pos := bytes.Index(data, compressions[i].magic)
+		if pos != -1 && (bestPos == -1 || pos < bestPos) {
+			bestPos = pos
+			best = &compressions[i]
+		}
+	}
+	return bestPos, best
+}
+
+// decompressAll decompresses everything that can be read from r into memory, which is
+// in use until e.release is called with the data. An error is returned if the decompressed
+// data does not fit in the memory that is left for the examination, or if the examination
+// decompresses more than it is allowed to.
+func decompressAll(e *examination, c *compression, r io.Reader) ([]byte, error) {
+	cr, err := e.decompress(c, r)
+	if err != nil {
+		return nil, err
+	}
+	defer cr.Close()
+	data, err := e.readAll(cr)
+	if err != nil && !errors.Is(err, errTooLarge) {
+		return nil, errors.New("could not decompress " + c.name + ": " + err.Error())
+	}
+	return data, err
+}
+
+// readAll reads everything that can be read from r into memory, which is in use until
+// e.release is called with the data. errTooLarge is returned if the data does not fit
+// in the memory that is left for the examination.
+func (e *examination) readAll(r io.Reader) ([]byte, error) {
+	left := e.memoryLeft()
+	data, err := io.ReadAll(io.LimitReader(r, left+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > left {
+		return nil, e.tooLarge()
+	}
+	e.inMemory += int64(len(data))
+	return data, nil
+}
+
+// release releases the memory of data that was read with e.readAll or decompressAll
+func (e *examination) release(data []byte) {
+	e.inMemory -= int64(len(data))
+}
+
+// memoryLeft returns how many more bytes the examination may hold in memory
+func (e *examination) memoryLeft() int64 {
+	return maxDecompressedSize - e.inMemory
+}
+
+// tooLarge returns the error for data that does not fit in the memory that is left for the examination
+func (e *examination) tooLarge() error {
+	if e.inMemory == 0 {
+		return fmt.Errorf("%w: larger than %d MiB", errTooLarge, maxDecompressedSize/(1024*1024))
+	}
+	return fmt.Errorf("%w: larger than the %d bytes that are left of %d MiB for all nesting levels", errTooLarge, e.memoryLeft(), maxDecompressedSize/(1024*1024))
+}
+
+// decompressStream returns a reader for the decompressed data that can be read
+// from r, if it is compressed with one of the supported compression formats.
+// If not, a reader for the data as it is is returned.
+func decompressStream(e *examination, r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, _ := br.Peek(8)
+	c := detectCompression(header)
+	if c == nil {
+		return io.NopCloser(br), nil
+	}
+	return e.decompress(c, br)
+}
+
+// decompress returns a reader for the data that is decompressed with c from r.
+// What is read counts against the decompression limit of the examination.
+func (e *examination) decompress(c *compression, r io.Reader) (io.ReadCloser, error) {
+	cr, err := c.reader(r)
+	if err != nil {
+		return nil, errors.New("could not decompress " + c.name + ": " + err.Error())
+	}
+	return &limitedDecompressor{cr, e}, nil
+}
+
+// limitedDecompressor is a reader for decompressed data, that fails with errTooLarge when
+// the examination has decompressed more than it is allowed to, in total
+type limitedDecompressor struct {
+	io.ReadCloser
+	e *examination
+}
+
+// Read reads decompressed data, and adds the number of bytes to what the examination has decompressed
+func (ld *limitedDecompressor) Read(p []byte) (int, error) {
+	n, err := ld.ReadCloser.Read(p)
+	ld.e.decompressed += int64(n)
+	if ld.e.maxDecompressed > 0 && ld.e.decompressed > ld.e.maxDecompressed {
+		return n, fmt.Errorf("%w: more than %d bytes were decompressed", errTooLarge, ld.e.maxDecompressed)
+	}
+	return n, err
+}
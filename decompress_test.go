@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// testCompress returns the given data, compressed with the given compression format
+func testCompress(t testing.TB, format string, data []byte) []byte {
+	t.Helper()
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+	)
+	switch format {
+	case "gzip":
+		return testGzip(t, data)
+	case "zstd":
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = zw
+	case "lz4":
+		w = lz4.NewWriter(&buf)
+	default:
+		t.Fatalf("can not compress with %s", format)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	exe := append(testELF(), make([]byte, 1<<20)...)
+	for _, format := range []string{"gzip", "zstd", "lz4"} {
+		for _, tc := range []struct {
+			name            string
+			maxDecompressed int64
+			tooLarge        bool
+		}{
+			{"no limit", 0, false},
+			{"within the limit", 2 << 20, false},
+			{"above the limit", 1 << 19, true},
+		} {
+			t.Run(format+" "+tc.name, func(t *testing.T) {
+				compressed := testCompress(t, format, exe)
+				if c := detectCompression(compressed); c == nil || c.name != format {
+					t.Fatalf("got %v, want %s", c, format)
+				}
+				e := &examination{ctx: context.Background(), maxDecompressed: tc.maxDecompressed}
+				results, err := examineBytes(e, compressed)
+				if tc.tooLarge {
+					if !errors.Is(err, errTooLarge) {
+						t.Fatalf("got %v, want %v", err, errTooLarge)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(results) != 1 || results[0].name != "" || results[0].compiler == "" {
+					t.Errorf("got %+v, want one result for the ELF file", results)
+				}
+			})
+		}
+	}
+}
+
+func TestIndexCompression(t *testing.T) {
+	gz := testGzip(t, []byte("data"))
+	for _, tc := range []struct {
+		name string
+		data []byte
+		pos  int
+		want string
+	}{
+		{"at the start", gz, 0, "gzip"},
+		{"after other data", append([]byte("setup code"), gz...), 10, "gzip"},
+		{"the first of several", append(append([]byte("xx"), testCompress(t, "zstd", nil)...), gz...), 2, "zstd"},
+		{"legacy lz4", []byte{0, 0x02, 0x21, 0x4c, 0x18}, 1, "lz4"},
+		{"bzip2", []byte("..BZh91AY&SY"), 2, "bzip2"},
+		{"none", []byte("uncompressed"), -1, ""},
+	} {
+		pos, c := indexCompression(tc.data)
+		name := ""
+		if c != nil {
+			name = c.name
+		}
+		if pos != tc.pos || name != tc.want {
+			t.Errorf("%s: got %d and %q, want %d and %q", tc.name, pos, name, tc.pos, tc.want)
+		}
+	}
+}
+
+// TestMemoryLimit checks that the memory limit is shared across nesting levels
+func TestMemoryLimit(t *testing.T) {
+	// As if the outer levels hold all but 100 bytes in memory
+	e := &examination{ctx: context.Background(), inMemory: maxDecompressedSize - 100}
+	if _, err := e.readAll(bytes.NewReader(make([]byte, 101))); !errors.Is(err, errTooLarge) {
+		t.Errorf("got %v, want %v", err, errTooLarge)
+	}
+	inner, err := e.readAll(bytes.NewReader(make([]byte, 100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.memoryLeft() != 0 {
+		t.Errorf("%d bytes are left", e.memoryLeft())
+	}
+	e.release(inner)
+	if e.memoryLeft() != 100 {
+		t.Errorf("%d bytes are left, want 100", e.memoryLeft())
+	}
+	e.inMemory = maxDecompressedSize - 100
+	results, err := examinePackageFile(e, "/a", bytes.NewReader(testELF()), 101, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resultNames(results); len(got) != 1 || !errors.Is(results[0].err, errTooLarge) {
+		t.Errorf("got %q, want an error for a file that is too large", got)
+	}
+}
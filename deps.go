@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ldCacheMagic     = "glibc-ld.so.cache1.1"
+	ldCacheHeader    = 48 // the size of the header of the new ld.so.cache format
+	ldCacheEntrySize = 24 // flags, key, value, OS version and hwcap
+)
+
+// errLibraryNotFound is the error for a shared library that could not be found
+var errLibraryNotFound = errors.New("not found")
+
+// depNode is a shared library in the dependency tree of an ELF file
+type depNode struct {
+	name     string  // the name, as given by DT_NEEDED
+	path     string  // the resolved path, within the root directory, or empty if not found
+	res      *result // what was found when examining the library, shared by the nodes for the same path
+	shown    bool    // the dependencies of this library are already shown elsewhere in the tree
+	children []*depNode
+}
+
+// depResolver resolves DT_NEEDED entries the same way as the glibc dynamic linker, without
+// executing anything. All paths are looked up within the root directory, if one is given.
+type depResolver struct {
+	root        rootFS
+	libraryPath []string            // from $LD_LIBRARY_PATH
+	ldCache     map[string][]string // library names and paths, from /etc/ld.so.cache
+	visited     map[string]*depNode
+}
+
+// newDepResolver creates a new dependency resolver for the given root directory
+func newDepResolver(root rootFS) *depResolver {
+	dr := &depResolver{root: root, visited: make(map[string]*depNode)}
+	if libraryPath := os.Getenv("LD_LIBRARY_PATH"); libraryPath != "" {
+		dr.libraryPath = strings.Split(libraryPath, ":")
+	}
+	return dr
+}
+
+// hostPath returns the path on the host for the given path within the root directory,
+// or an empty string if the path could not be resolved
+func (dr *depResolver) hostPath(p string) string {
+	hostPath, err := dr.root.resolve(p)
+	if err != nil {
+		return ""
+	}
+	return hostPath
+}
+
+// parseLdCache parses the library names and paths in the given ld.so.cache data.
+// The new format may be preceded by the old format, which is skipped.
+func parseLdCache(data []byte, byteOrder binary.ByteOrder) (map[string][]string, error) {
+	pos := bytes.Index(data, []byte(ldCacheMagic))
+	if pos == -1 {
+		return nil, errors.New("unsupported ld.so.cache format")
+	}
+	// String offsets are relative to the start of the new format header
+	data = data[pos:]
+	if len(data) < ldCacheHeader {
+		return nil, errors.New("truncated ld.so.cache")
+	}
+	count := int(byteOrder.Uint32(data[len(ldCacheMagic):]))
+	if count > (len(data)-ldCacheHeader)/ldCacheEntrySize {
+		return nil, errors.New("corrupt ld.so.cache")
+	}
+	cString := func(offset uint32) string {
+		if int(offset) >= len(data) {
+			return ""
+		}
+		s := data[offset:]
+		if end := bytes.IndexByte(s, 0); end != -1 {
+			s = s[:end]
+		}
+		return string(s)
+	}
+	entries := make(map[string][]string)
+	for i := 0; i < count; i++ {
+		entry := data[ldCacheHeader+i*ldCacheEntrySize:]
+		key, value := cString(byteOrder.Uint32(entry[4:])), cString(byteOrder.Uint32(entry[8:]))
+		if key != "" && value != "" {
+			entries[key] = append(entries[key], value)
+		}
+	}
+	return entries, nil
+}
+
+// ldCacheLookup looks up the given library name in /etc/ld.so.cache, which is read on first use
+func (dr *depResolver) ldCacheLookup(name string, byteOrder binary.ByteOrder) []string {
+	if dr.ldCache == nil {
+		dr.ldCache = make(map[string][]string)
+		if data, err := os.ReadFile(dr.hostPath("/etc/ld.so.cache")); err == nil {
+			if entries, err := parseLdCache(data, byteOrder); err == nil {
+				dr.ldCache = entries
+			}
+		}
+	}
+	return dr.ldCache[name]
+}
+
+// defaultDirs returns the directories that the dynamic linker searches last
+func defaultDirs(f *elf.File) []string {
+	if f.Class == elf.ELFCLASS64 {
+		return []string{"/lib64", "/usr/lib64", "/lib", "/usr/lib"}
+	}
+	return []string{"/lib", "/usr/lib"}
+}
+
+// expandOrigin expands $ORIGIN and $LIB in the given DT_RPATH or DT_RUNPATH,
+// and returns the list of directories
+func expandOrigin(searchPath, origin string, f *elf.File) []string {
+	lib := "lib"
+	if f.Class == elf.ELFCLASS64 {
+		lib = "lib64"
+	}
+	var dirs []string
+	for _, dir := range strings.Split(searchPath, ":") {
+		if dir == "" {
+			continue
+		}
+		dir = strings.NewReplacer("${ORIGIN}", origin, "$ORIGIN", origin, "${LIB}", lib, "$LIB", lib).Replace(dir)
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// compatible checks if the ELF file at the given host path can be loaded together with f
+func compatible(hostPath string, f *elf.File) bool {
+	lib, err := elf.Open(hostPath)
+	if err != nil {
+		return false
+	}
+	defer lib.Close()
+	return lib.Class == f.Class && lib.Machine == f.Machine && lib.Type == elf.ET_DYN
+}
+
+// dynStrings returns the dynamic section entries of the given type, joined with ":"
+func dynStrings(f *elf.File, tag elf.DynTag) string {
+	values, err := f.DynString(tag)
+	if err != nil {
+		return ""
+	}
+	return strings.Join(values, ":")
+}
+
+// loader is an object in the chain of objects that caused a library to be loaded,
+// which is needed since the DT_RPATH of every object in the chain is searched
+type loader struct {
+	rpath  []string
+	parent *loader
+}
+
+// resolve finds the given library, needed by the object f, and returns the path within
+// the root directory, or an empty string if it could not be found.
+// The search order is DT_RPATH, $LD_LIBRARY_PATH, DT_RUNPATH, /etc/ld.so.cache and the default dirs.
+func (dr *depResolver) resolve(name string, f *elf.File, chain *loader, runpath []string) string {
+	if strings.Contains(name, "/") {
+		if compatible(dr.hostPath(name), f) {
+			return name
+		}
+		return ""
+	}
+	var dirs []string
+	// DT_RPATH is only used if the object that needs the library has no DT_RUNPATH
+	if len(runpath) == 0 {
+		for l := chain; l != nil; l = l.parent {
+			dirs = append(dirs, l.rpath...)
+		}
+	}
+	dirs = append(dirs, dr.libraryPath...)
+	dirs = append(dirs, runpath...)
+	for _, dir := range dirs {
+		if p := filepath.Join(dir, name); compatible(dr.hostPath(p), f) {
+			return p
+		}
+	}
+	for _, p := range dr.ldCacheLookup(name, f.ByteOrder) {
+		if compatible(dr.hostPath(p), f) {
+			return p
+		}
+	}
+	for _, dir := range defaultDirs(f) {
+		if p := filepath.Join(dir, name); compatible(dr.hostPath(p), f) {
+			return p
+		}
+	}
+	return ""
+}
+
+// dependencies resolves the libraries that the ELF file at path p (within the root directory) needs,
+// recursively. Libraries that have already been visited are marked as shown, and not recursed into.
+// When the examination stops, the libraries so far are returned, with detect.ErrTimedOut or
+// detect.ErrCancelled.
+func (dr *depResolver) dependencies(e *examination, p string, chain *loader) ([]*depNode, error) {
+	hostPath, err := dr.root.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	f, err := elf.Open(hostPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	needed, err := f.DynString(elf.DT_NEEDED)
+	if err != nil {
+		return nil, err
+	}
+	origin := filepath.Dir(p)
+	chain = &loader{rpath: expandOrigin(dynStrings(f, elf.DT_RPATH), origin, f), parent: chain}
+	runpath := expandOrigin(dynStrings(f, elf.DT_RUNPATH), origin, f)
+	var nodes []*depNode
+	for _, name := range needed {
+		if err := e.stopped(); err != nil {
+			return nodes, err
+		}
+		node := &depNode{name: name, path: dr.resolve(name, f, chain, runpath)}
+		nodes = append(nodes, node)
+		if node.path == "" {
+			continue
+		}
+		if seen, ok := dr.visited[node.path]; ok {
+			node.res, node.shown = seen.res, true
+			continue
+		}
+		dr.visited[node.path] = node
+		res := examineNamedFile(e, node.path, dr.hostPath(node.path))
+		node.res = &res
+		if res.err != nil {
+			continue
+		}
+		children, err := dr.dependencies(e, node.path, chain)
+		node.children = children
+		if err := e.stopped(); err != nil {
+			return nodes, err
+		}
+		if err != nil {
+			res.err = err
+		}
+	}
+	return nodes, nil
+}
+
+// depResults returns the results for the libraries in the given dependency tree, once per
+// library, in the order they are first found. Libraries that were not found are included,
+// with errLibraryNotFound.
+func depResults(nodes []*depNode) []result {
+	var results []result
+	for _, node := range nodes {
+		switch {
+		case node.path == "":
+			results = append(results, result{name: node.name, err: errLibraryNotFound})
+		case !node.shown:
+			results = append(results, *node.res)
+			results = append(results, depResults(node.children)...)
+		}
+	}
+	return results
+}
+
+// printDeps outputs the given dependency tree, with the findings for each library
+func printDeps(nodes []*depNode, indent string) {
+	for _, node := range nodes {
+		switch {
+		case node.path == "":
+			fmt.Printf("%s%s => not found\n", indent, node.name)
+			continue
+		case node.res.err != nil:
+			fmt.Printf("%s%s => %s: %s\n", indent, node.name, node.path, node.res.err)
+		case node.shown:
+			fmt.Printf("%s%s => %s: %s (see above)\n", indent, node.name, node.path, node.res.String())
+			continue
+		default:
+			fmt.Printf("%s%s => %s: %s\n", indent, node.name, node.path, node.res.String())
+		}
+		for _, fi := range node.res.findings {
+			fmt.Printf("%s    %s\n", indent, fi.String())
+		}
+		printDeps(node.children, indent+"    ")
+	}
+}
+
+// examineDeps examines the given ELF file (within the root directory of the examination) and
+// all of the shared libraries that it depends on. The results are for the file, without a name,
+// followed by one result per library, named after its path. When the examination stops, the
+// results so far are returned, with detect.ErrTimedOut or detect.ErrCancelled.
+func examineDeps(e *examination, filename string) ([]result, []*depNode, error) {
+	dr := newDepResolver(e.root)
+	hostPath, err := e.root.resolve(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	res := examineNamedFile(e, "", hostPath)
+	if res.err != nil {
+		return nil, nil, errors.New(filename + ": " + res.err.Error())
+	}
+	nodes, err := dr.dependencies(e, filename, nil)
+	results := append([]result{res}, depResults(nodes)...)
+	if err != nil {
+		return results, nodes, fmt.Errorf("%s: %w", filename, err)
+	}
+	return results, nodes, nil
+}
+
+// outputDeps examines the given ELF file and the shared libraries it depends on, checks the
+// results and outputs them in the given format. For text, the dependency tree is output.
+// The number of findings is returned, and an error if any libraries are missing.
+func outputDeps(filename string, root rootFS, opts *options) (int, error) {
+	e, cancel := opts.newExamination(root)
+	defer cancel()
+	results, nodes, err := examineDeps(e, filename)
+	if len(results) == 0 {
+		return 0, err
+	}
+	findings := opts.checkResults(results)
+	if opts.format == "text" {
+		fmt.Printf("%s: %s\n", filename, results[0].String())
+		for _, fi := range results[0].findings {
+			fmt.Printf("%s: %s\n", filename, fi.String())
+		}
+		printDeps(nodes, "    ")
+	} else {
+		hostPath, _ := root.resolve(filename)
+		if outputErr := output(filename, hostPath, results, opts); outputErr != nil {
+			return findings, outputErr
+		}
+	}
+	if err != nil {
+		return findings, err
+	}
+	var missing []string
+	for _, res := range results {
+		if errors.Is(res.err, errLibraryNotFound) {
+			missing = append(missing, res.name)
+		}
+	}
+	if len(missing) > 0 {
+		return findings, errors.New(filename + ": missing libraries: " + strings.Join(missing, ", "))
+	}
+	return findings, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// testLdCache returns an ld.so.cache in the new format with the given library names and paths,
+// optionally preceded by the old format
+func testLdCache(byteOrder binary.ByteOrder, old bool, entries ...string) []byte {
+	var (
+		table bytes.Buffer
+		names bytes.Buffer
+	)
+	namesStart := ldCacheHeader + len(entries)/2*ldCacheEntrySize
+	for i := 0; i+1 < len(entries); i += 2 {
+		key := namesStart + names.Len()
+		names.WriteString(entries[i] + "\x00")
+		value := namesStart + names.Len()
+		names.WriteString(entries[i+1] + "\x00")
+		binary.Write(&table, byteOrder, []uint32{0x303, uint32(key), uint32(value), 0})
+		binary.Write(&table, byteOrder, uint64(0))
+	}
+	header := make([]byte, ldCacheHeader)
+	copy(header, ldCacheMagic)
+	byteOrder.PutUint32(header[len(ldCacheMagic):], uint32(len(entries)/2))
+	byteOrder.PutUint32(header[len(ldCacheMagic)+4:], uint32(names.Len()))
+	var data []byte
+	if old {
+		// The old format has a header with the number of entries, and entries of 12 bytes
+		data = append([]byte("ld.so-1.7.0\x00"), 1, 0, 0, 0)
+		data = append(data, make([]byte, 12)...)
+	}
+	data = append(data, header...)
+	data = append(data, table.Bytes()...)
+	return append(data, names.Bytes()...)
+}
+
+func TestParseLdCache(t *testing.T) {
+	libs := []string{
+		"libc.so.6", "/lib/x86_64-linux-gnu/libc.so.6",
+		"libc.so.6", "/lib/i386-linux-gnu/libc.so.6",
+		"libm.so.6", "/lib/x86_64-linux-gnu/libm.so.6",
+	}
+	want := map[string][]string{
+		"libc.so.6": {"/lib/x86_64-linux-gnu/libc.so.6", "/lib/i386-linux-gnu/libc.so.6"},
+		"libm.so.6": {"/lib/x86_64-linux-gnu/libm.so.6"},
+	}
+	outOfRange := testLdCache(binary.LittleEndian, false, "libc.so.6", "/lib/libc.so.6", "libz.so.1", "/lib/libz.so.1")
+	binary.LittleEndian.PutUint32(outOfRange[ldCacheHeader+ldCacheEntrySize+8:], 1<<20)
+	for _, tc := range []struct {
+		name      string
+		data      []byte
+		byteOrder binary.ByteOrder
+		want      map[string][]string
+		err       string
+	}{
+		{"little endian", testLdCache(binary.LittleEndian, false, libs...), binary.LittleEndian, want, ""},
+		{"big endian", testLdCache(binary.BigEndian, false, libs...), binary.BigEndian, want, ""},
+		{"after the old format", testLdCache(binary.LittleEndian, true, libs...), binary.LittleEndian, want, ""},
+		{"empty", testLdCache(binary.LittleEndian, false), binary.LittleEndian, map[string][]string{}, ""},
+		{"a path out of range", outOfRange, binary.LittleEndian, map[string][]string{"libc.so.6": {"/lib/libc.so.6"}}, ""},
+		{"only the old format", []byte("ld.so-1.7.0\x00\x00\x00\x00\x00"), binary.LittleEndian, nil, "unsupported ld.so.cache format"},
+		{"truncated", testLdCache(binary.LittleEndian, false)[:ldCacheHeader-1], binary.LittleEndian, nil, "truncated ld.so.cache"},
+		{"wrong byte order", testLdCache(binary.LittleEndian, false, libs...), binary.BigEndian, nil, "corrupt ld.so.cache"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseLdCache(tc.data, tc.byteOrder)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("got the error %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestParseHostLdCache checks that the ld.so.cache of the host can be parsed, if there is one
+func TestParseHostLdCache(t *testing.T) {
+	data, err := os.ReadFile("/etc/ld.so.cache")
+	if err != nil {
+		t.Skip(err)
+	}
+	entries, err := parseLdCache(data, binary.NativeEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 {
+		t.Error("no libraries in /etc/ld.so.cache")
+	}
+}
+
+func TestExpandOrigin(t *testing.T) {
+	f64 := &elf.File{FileHeader: elf.FileHeader{Class: elf.ELFCLASS64}}
+	f32 := &elf.File{FileHeader: elf.FileHeader{Class: elf.ELFCLASS32}}
+	for _, tc := range []struct {
+		searchPath string
+		f          *elf.File
+		want       []string
+	}{
+		{"$ORIGIN/../lib:/opt/x/lib", f64, []string{"/usr/bin/../lib", "/opt/x/lib"}},
+		{"${ORIGIN}/${LIB}::$LIB", f64, []string{"/usr/bin/lib64", "lib64"}},
+		{"/opt/$LIB", f32, []string{"/opt/lib"}},
+		{"", f64, nil},
+	} {
+		if got := expandOrigin(tc.searchPath, "/usr/bin", tc.f); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %q, want %q", tc.searchPath, got, tc.want)
+		}
+	}
+}
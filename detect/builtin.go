@@ -0,0 +1,161 @@
+package detect
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"io"
+	"regexp"
+)
+
+const (
+	// maxEvidenceLength is the longest matched string that is kept as evidence
+	maxEvidenceLength = 80
+
+	// evidenceContext is how many printable characters around a match are kept as evidence
+	evidenceContext = 32
+)
+
+// rustVersionRegex matches compiler strings from Rust executables that include the rustc version
+var rustVersionRegex = regexp.MustCompile(`^Rust \d`)
+
+// HasRustVersion checks if the given compiler description is from a Rust executable and includes the rustc version
+func HasRustVersion(compiler string) bool {
+	return rustVersionRegex.MatchString(compiler)
+}
+
+// isPrintable checks if the given byte is a printable ASCII character
+func isPrintable(b byte) bool {
+	return b >= 0x20 && b < 0x7f
+}
+
+// FindEvidence searches the given sections for each of the given strings, and returns the
+// first occurrence of each one that is found, with the printable characters around it
+func FindEvidence(r io.ReaderAt, f *elf.File, detectorName string, sections []string, needles []string) []Evidence {
+	var found []Evidence
+	done := make([]bool, len(needles))
+	for _, name := range sections {
+		sec := DebugSection(f, name)
+		if sec == nil || len(found) == len(needles) {
+			continue
+		}
+		data, err := ReadSection(r, f, sec)
+		if err != nil {
+			continue
+		}
+		for i, needle := range needles {
+			if done[i] || needle == "" {
+				continue
+			}
+			pos := bytes.Index(data, []byte(needle))
+			if pos == -1 {
+				continue
+			}
+			done[i] = true
+			start, end := pos, pos+len(needle)
+			for start > 0 && pos-start < evidenceContext && isPrintable(data[start-1]) {
+				start--
+			}
+			for end < len(data) && end-pos-len(needle) < evidenceContext && isPrintable(data[end]) {
+				end++
+			}
+			found = append(found, Evidence{Detector: detectorName, Section: sec.Name, Offset: int64(start), Match: string(data[start:end])})
+		}
+	}
+	return found
+}
+
+// sectionEvidence returns evidence for the presence or the absence of the given section
+func sectionEvidence(f *elf.File, detectorName, section string) Evidence {
+	if f.Section(section) == nil {
+		return Evidence{Detector: detectorName, Offset: -1, Match: "no " + section + " section"}
+	}
+	return Evidence{Detector: detectorName, Offset: -1, Match: "has a " + section + " section"}
+}
+
+// funcDetector is a detector that calls a function that returns a compiler description,
+// or an empty string, like the functions that ainur provides. Since the function does not tell
+// where it found the compiler, the given sections are searched for the strings that
+// needles returns, as evidence.
+type funcDetector struct {
+	name       string
+	priority   int
+	confidence float64 // when a version is found, and half of it if not
+	sections   []string
+	needles    func(d Detection) []string
+	fn         func(ctx context.Context, r io.ReaderAt, f *elf.File) string
+}
+
+func (d *funcDetector) Name() string  { return d.name }
+func (d *funcDetector) Priority() int { return d.priority }
+
+func (d *funcDetector) Detect(ctx context.Context, r io.ReaderAt, f *elf.File) (Detection, bool) {
+	s := d.fn(ctx, r, f)
+	if s == "" {
+		return Detection{}, false
+	}
+	found := ParseDetection(s)
+	found.Detector = d.name
+	found.Confidence = d.confidence
+	if found.Version == "" {
+		found.Confidence /= 2
+	}
+	found.Evidence = FindEvidence(r, f, d.name, d.sections, d.needles(found))
+	return found, true
+}
+
+// versionNeedle returns the given prefix followed by the version that was found, if any
+func versionNeedle(prefix string) func(Detection) []string {
+	return func(d Detection) []string {
+		if d.Version == "" {
+			return nil
+		}
+		return []string{prefix + d.Version}
+	}
+}
+
+// rustVer returns the Rust compiler version from the debug information, which may be
+// compressed, or a description of the Rust runtime for stripped Rust executables
+func rustVer(ctx context.Context, r io.ReaderAt, f *elf.File) string {
+	unstripped := rustVerUnstripped(ctx, r, f)
+	if HasRustVersion(unstripped) {
+		return unstripped
+	}
+	if rustVersion := rustVerCompressed(ctx, r, f); rustVersion != "" {
+		return rustVersion
+	}
+	if unstripped != "" {
+		return unstripped
+	}
+	return rustVerStripped(ctx, r, f)
+}
+
+// newDefaultRegistry returns a registry with the built-in detectors that are written in Go,
+// in the same order as ainur.Compiler tries them, from the more specific to the more ambiguous,
+// and the detectors for D, Free Pascal and TCC, which are embedded rule files.
+func newDefaultRegistry() *Registry {
+	reg := NewRegistry(
+		&funcDetector{"go", 90, 0.95, []string{".go.buildinfo", ".rodata", ".gosymtab"}, versionNeedle("go"), goVer},
+		&funcDetector{"ocaml", 80, 0.8, []string{".rodata"}, func(d Detection) []string {
+			return []string{"[ocaml]", d.Version}
+		}, ocamlVer},
+		&funcDetector{"ghc", 70, 0.9, []string{".comment"}, versionNeedle("GHC "), ghcVer},
+		&funcDetector{"rust", 60, 0.9, []string{".debug_str", ".rodata"}, func(d Detection) []string {
+			if d.Version != "" {
+				return []string{"rustc version " + d.Version}
+			}
+			return []string{"/rustc-", "__rust_"}
+		}, rustVer},
+		&funcDetector{"gcc", 40, 0.8, []string{".comment"}, func(d Detection) []string {
+			return []string{d.Version}
+		}, gccVer},
+	)
+	rules, err := builtinRules()
+	if err != nil {
+		panic(err) // the embedded rules are checked when they are changed
+	}
+	for _, rule := range rules {
+		reg.Register(rule)
+	}
+	return reg
+}
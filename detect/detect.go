@@ -0,0 +1,257 @@
+// Package detect finds the compiler and compiler version that an ELF file was built with.
+// The compiler is found by a registry of detectors, which are tried from the more specific
+// to the more ambiguous ones. Detectors can be added by implementing the Detector interface,
+// or by writing JSON rule files.
+package detect
+
+import (
+	"context"
+	"debug/elf"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Evidence is something that was found in an ELF file, that a detection is based on
+type Evidence struct {
+	Detector string // the detector or rule that found it
+	Section  string // the section it was found in, if any
+	Offset   int64  // the offset within the section, or -1 if it is not about a location
+	Match    string // the matched bytes, or a description, like "no .note.ABI-tag section"
+}
+
+// String returns the location and the matched bytes, like `.comment+0x0: "GCC: (GNU) 13.2.1" (gcc)`
+func (e *Evidence) String() string {
+	if e.Offset < 0 {
+		return e.Match + " (" + e.Detector + ")"
+	}
+	return e.Section + "+0x" + strconv.FormatInt(e.Offset, 16) + ": " + strconv.Quote(e.Match) + " (" + e.Detector + ")"
+}
+
+// Detection is a compiler that a detector found, like "GCC 13.2.1" or "Rust (GCC 8.1.0)"
+type Detection struct {
+	Name         string
+	Version      string // may be empty
+	Extra        string // the rest of the description, like "(GCC 8.1.0)" for stripped Rust executables
+	Detector     string // the name of the detector that found it
+	Confidence   float64
+	Evidence     []Evidence
+	Alternatives []Detection // what the other detectors found, from Registry.DetectAll
+}
+
+// ParseDetection splits a compiler description, like "Rust 1.75.0 (GCC 13.2.1)", into a Detection
+func ParseDetection(s string) Detection {
+	var d Detection
+	if pos := strings.Index(s, " ("); pos != -1 {
+		s, d.Extra = s[:pos], s[pos+1:]
+	}
+	d.Name, d.Version = s, ""
+	if pos := strings.LastIndex(s, " "); pos != -1 && startsWithDigit(s[pos+1:]) {
+		d.Name, d.Version = s[:pos], s[pos+1:]
+	}
+	return d
+}
+
+// startsWithDigit checks if the given string starts with a digit
+func startsWithDigit(s string) bool {
+	return s != "" && s[0] >= '0' && s[0] <= '9'
+}
+
+// String returns the compiler description, like "GCC 13.2.1"
+func (d Detection) String() string {
+	s := d.Name
+	if d.Version != "" {
+		s += " " + d.Version
+	}
+	if d.Extra != "" {
+		s += " " + d.Extra
+	}
+	return s
+}
+
+// Detector finds the compiler that an ELF file was built with, if it is one that it knows about.
+// r is what the ELF file is read from, for reading sections with OpenSection or ReadSection.
+// Detectors that search through sections should stop when ctx is done, for instance by
+// searching with a StreamReader. What they found then is not used.
+type Detector interface {
+	Name() string  // a short name, like "go" or "rust"
+	Priority() int // detectors with a higher priority are tried first
+	Detect(ctx context.Context, r io.ReaderAt, f *elf.File) (Detection, bool)
+}
+
+// registeredDetector is a detector in a registry, with a priority that may have been changed
+type registeredDetector struct {
+	Detector
+	priority int
+}
+
+// Registry is an ordered set of detectors, from the highest to the lowest priority.
+// It is safe for concurrent use.
+type Registry struct {
+	mutex     sync.RWMutex
+	detectors []registeredDetector
+}
+
+// NewRegistry returns a registry with the given detectors
+func NewRegistry(detectors ...Detector) *Registry {
+	reg := &Registry{}
+	for _, d := range detectors {
+		reg.Register(d)
+	}
+	return reg
+}
+
+// sort orders the detectors by priority. Detectors with the same priority keep their order.
+func (reg *Registry) sort() {
+	sort.SliceStable(reg.detectors, func(i, j int) bool {
+		return reg.detectors[i].priority > reg.detectors[j].priority
+	})
+}
+
+// index returns the position of the detector with the given name, or -1
+func (reg *Registry) index(name string) int {
+	for i, d := range reg.detectors {
+		if d.Name() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Register adds the given detector, or replaces the detector with the same name
+func (reg *Registry) Register(d Detector) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	if i := reg.index(d.Name()); i != -1 {
+		reg.detectors[i] = registeredDetector{d, d.Priority()}
+	} else {
+		reg.detectors = append(reg.detectors, registeredDetector{d, d.Priority()})
+	}
+	reg.sort()
+}
+
+// Unregister removes the detector with the given name, and reports if it was registered
+func (reg *Registry) Unregister(name string) bool {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	i := reg.index(name)
+	if i == -1 {
+		return false
+	}
+	reg.detectors = append(reg.detectors[:i], reg.detectors[i+1:]...)
+	return true
+}
+
+// SetPriority changes the priority of the detector with the given name, which changes the order
+func (reg *Registry) SetPriority(name string, priority int) error {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	i := reg.index(name)
+	if i == -1 {
+		return errors.New("unknown detector: " + name)
+	}
+	reg.detectors[i].priority = priority
+	reg.sort()
+	return nil
+}
+
+// Names returns the names of the detectors, in order
+func (reg *Registry) Names() []string {
+	reg.mutex.RLock()
+	defer reg.mutex.RUnlock()
+	names := make([]string, 0, len(reg.detectors))
+	for _, d := range reg.detectors {
+		names = append(names, d.Name())
+	}
+	return names
+}
+
+// Has checks if a detector with the given name is registered
+func (reg *Registry) Has(name string) bool {
+	reg.mutex.RLock()
+	defer reg.mutex.RUnlock()
+	return reg.index(name) != -1
+}
+
+// list returns a copy of the detectors, so that they can be tried without holding the lock
+func (reg *Registry) list() []Detector {
+	reg.mutex.RLock()
+	defer reg.mutex.RUnlock()
+	list := make([]Detector, 0, len(reg.detectors))
+	for _, d := range reg.detectors {
+		list = append(list, d.Detector)
+	}
+	return list
+}
+
+// safeDetect calls the Detect method of the given detector. A detector that panics, for
+// instance because of a malformed ELF file, is treated as if it did not find a compiler,
+// so that the other detectors can still be tried.
+func safeDetect(ctx context.Context, d Detector, r io.ReaderAt, f *elf.File) (found Detection, ok bool) {
+	defer func() {
+		if recover() != nil {
+			found, ok = Detection{}, false
+		}
+	}()
+	return d.Detect(ctx, r, f)
+}
+
+// Detect tries the detectors in order, and returns the first compiler that is found,
+// or "unknown". If the context is done before a compiler is found, ErrTimedOut or
+// ErrCancelled is returned.
+func (reg *Registry) Detect(ctx context.Context, r io.ReaderAt, f *elf.File) (Detection, error) {
+	for _, d := range reg.list() {
+		found, ok := safeDetect(ctx, d, r, f)
+		if err := ContextError(ctx); err != nil {
+			return Detection{}, err
+		}
+		if ok {
+			return found, nil
+		}
+	}
+	return Detection{Name: "unknown"}, nil
+}
+
+// DetectAll is the same as Detect, but all detectors are tried, and what the other
+// detectors found is included as alternatives, for explaining the result
+func (reg *Registry) DetectAll(ctx context.Context, r io.ReaderAt, f *elf.File) (Detection, error) {
+	var all []Detection
+	for _, d := range reg.list() {
+		found, ok := safeDetect(ctx, d, r, f)
+		if err := ContextError(ctx); err != nil {
+			return Detection{}, err
+		}
+		if ok {
+			all = append(all, found)
+		}
+	}
+	if len(all) == 0 {
+		return Detection{Name: "unknown"}, nil
+	}
+	all[0].Alternatives = all[1:]
+	return all[0], nil
+}
+
+// Compiler returns the compiler that is found by the detectors, or "unknown"
+func (reg *Registry) Compiler(r io.ReaderAt, f *elf.File) string {
+	d, _ := reg.Detect(context.Background(), r, f)
+	return d.String()
+}
+
+// Default is the registry with the built-in detectors and the embedded rules,
+// which is used when no other registry is given
+var Default = newDefaultRegistry()
+
+// Register adds the given detector to the default registry, or replaces the detector with the same name
+func Register(d Detector) {
+	Default.Register(d)
+}
+
+// Compiler returns the compiler that is found by the detectors in the default registry,
+// like "GCC 13.2.1", or "unknown"
+func Compiler(r io.ReaderAt, f *elf.File) string {
+	return Default.Compiler(r, f)
+}
@@ -0,0 +1,249 @@
+package detect
+
+import (
+	"bytes"
+	"context"
+	"debug/buildinfo"
+	"debug/elf"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readTestdata returns the contents of the given file in the testdata directory
+func readTestdata(t testing.TB, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestExamineBytes(t *testing.T) {
+	for name, want := range map[string]string{
+		"gcc.o":           "GCC 12.2.0",
+		"clang.o":         "Clang 16.0.6",
+		"ghc.o":           "GHC 9.4.7",
+		"go.o":            "Go 1.22.5",
+		"ocaml.o":         "OCaml 4.14.1",
+		"rust.o":          "Rust 1.75.0",
+		"rust-zlib.o":     "Rust 1.75.0",
+		"rust-stripped.o": "Rust (GCC 12.2.0)",
+		"pascal.o":        "FPC 3.2.2",
+		"d.o":             "DMD",
+		"tcc.o":           "TCC",
+		"unknown.o":       "unknown",
+	} {
+		got, err := ExamineBytes(readTestdata(t, name))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestExamineBytesErrors(t *testing.T) {
+	data := readTestdata(t, "gcc.o")
+	badClass := bytes.Clone(data)
+	badClass[elf.EI_CLASS] = 9
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"text", []byte("#!/bin/sh\necho hello\n"), ErrNotELF},
+		{"empty", nil, ErrNotELF},
+		{"header only", data[:elf.EI_NIDENT], ErrTruncated},
+		{"cut off", data[:len(data)/2], ErrTruncated},
+		{"bad class", badClass, ErrUnsupportedArch},
+	} {
+		if _, err := ExamineBytes(tc.data); !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestExamineContext(t *testing.T) {
+	data := readTestdata(t, "rust.o")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ExamineContext(ctx, bytes.NewReader(data), int64(len(data)), Options{}); !errors.Is(err, ErrCancelled) {
+		t.Errorf("got %v, want %v", err, ErrCancelled)
+	}
+	if _, err := ExamineStaticContext(ctx, bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrCancelled) {
+		t.Errorf("got %v, want %v", err, ErrCancelled)
+	}
+}
+
+func TestStreamReader(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	sr, err := NewStreamReader(context.Background(), bytes.NewReader(data), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for {
+		b, err := sr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(bytes.TrimLeft(b, "\x00")))
+	}
+	want := []string{"0123", "01234567", "456789ab", "89abcdef", "cdefghij"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := NewStreamReader(context.Background(), bytes.NewReader(data), 7); err == nil {
+		t.Error("expected an error for an odd buffer size")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sr, _ = NewStreamReader(ctx, bytes.NewReader(data), 8)
+	if _, err := sr.Next(); !errors.Is(err, ErrCancelled) {
+		t.Errorf("got %v, want %v", err, ErrCancelled)
+	}
+}
+
+// stubDetector finds the given compiler in every ELF file, or panics if the compiler is empty
+type stubDetector struct {
+	name     string
+	priority int
+	compiler string
+}
+
+func (d *stubDetector) Name() string  { return d.name }
+func (d *stubDetector) Priority() int { return d.priority }
+
+func (d *stubDetector) Detect(ctx context.Context, r io.ReaderAt, f *elf.File) (Detection, bool) {
+	if d.compiler == "" {
+		panic("no compiler")
+	}
+	return Detection{Name: d.compiler, Detector: d.name}, true
+}
+
+func TestRegistry(t *testing.T) {
+	data := readTestdata(t, "unknown.o")
+	f, err := NewFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(data)
+	reg := NewRegistry(&stubDetector{"a", 10, "A"}, &stubDetector{"b", 20, "B"}, &stubDetector{"panics", 30, ""})
+	if got, want := reg.Names(), []string{"panics", "b", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := reg.Compiler(r, f); got != "B" {
+		t.Errorf("got %q, want %q, since the detector that panics is skipped", got, "B")
+	}
+	if err := reg.SetPriority("a", 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.SetPriority("c", 100); err == nil {
+		t.Error("expected an error for an unknown detector")
+	}
+	if got := reg.Compiler(r, f); got != "A" {
+		t.Errorf("got %q, want %q after changing the priority", got, "A")
+	}
+	d, err := reg.DetectAll(context.Background(), r, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "A" || len(d.Alternatives) != 1 || d.Alternatives[0].Name != "B" {
+		t.Errorf("got %+v, want A with B as an alternative", d)
+	}
+	if !reg.Unregister("a") || reg.Unregister("a") || reg.Has("a") {
+		t.Error("expected a to be unregistered once")
+	}
+	reg.Register(&stubDetector{"b", 0, "C"})
+	if got, want := reg.Names(), []string{"panics", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := reg.Compiler(r, f); got != "C" {
+		t.Errorf("got %q, want %q after replacing a detector", got, "C")
+	}
+	if got := NewRegistry().Compiler(r, f); got != "unknown" {
+		t.Errorf("got %q, want %q for an empty registry", got, "unknown")
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule([]byte(`{"name": "fpc", "compiler": "Free Pascal", "sections": [".data"], "version": "FPC (?P<version>[0-9.]+)"}`), "fpc.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := readTestdata(t, "pascal.o")
+	got, err := ExamineReader(bytes.NewReader(data), int64(len(data)), Options{Registry: NewRegistry(rule)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Free Pascal 3.2.2"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := ParseRule([]byte(`{"name": "broken"}`), "broken.json"); err == nil {
+		t.Error("expected an error for a rule without a compiler")
+	}
+}
+
+// TestGoBuildInfo checks that the Go version is the one in the build information, by
+// examining the test binary, which is built with the Go compiler that runs the tests
+func TestGoBuildInfo(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bi, err := buildinfo.ReadFile(exe)
+	if err != nil {
+		t.Skip("the test binary has no build information:", err)
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ExamineReader(f, fi.Size(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Go " + strings.TrimPrefix(strings.Fields(bi.GoVersion)[0], "go"); got != want {
+		t.Errorf("got %q, want %q from the build information", got, want)
+	}
+}
+
+func TestParseDetection(t *testing.T) {
+	for _, tc := range []struct {
+		s       string
+		want    Detection
+		hasRust bool
+	}{
+		{"GCC 13.2.1", Detection{Name: "GCC", Version: "13.2.1"}, false},
+		{"Rust 1.75.0 (GCC 13.2.1)", Detection{Name: "Rust", Version: "1.75.0", Extra: "(GCC 13.2.1)"}, true},
+		{"Rust (unknown rustc commit 0123abcd)", Detection{Name: "Rust", Extra: "(unknown rustc commit 0123abcd)"}, false},
+		{"Free Pascal", Detection{Name: "Free Pascal"}, false},
+		{"LLD 17.0.6", Detection{Name: "LLD", Version: "17.0.6"}, false},
+		{"unknown", Detection{Name: "unknown"}, false},
+	} {
+		got := ParseDetection(tc.s)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %+v, want %+v", tc.s, got, tc.want)
+		}
+		if got.String() != tc.s {
+			t.Errorf("%q: got %q back", tc.s, got.String())
+		}
+		if HasRustVersion(tc.s) != tc.hasRust {
+			t.Errorf("%q: HasRustVersion returned %v", tc.s, !tc.hasRust)
+		}
+	}
+}
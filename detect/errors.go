@@ -0,0 +1,100 @@
+package detect
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Errors for files that can not be examined, which can be told apart with errors.Is
+var (
+	ErrNotELF          = errors.New("Not an ELF")
+	ErrTruncated       = errors.New("truncated ELF file")
+	ErrUnsupportedArch = errors.New("unsupported ELF class or byte order")
+	ErrCorrupt         = errors.New("corrupt ELF file")
+)
+
+// SectionError is an error for a section that could not be read, which can be found with errors.As
+type SectionError struct {
+	Section string
+	Err     error
+}
+
+func (e *SectionError) Error() string {
+	return e.Section + ": " + e.Err.Error()
+}
+
+func (e *SectionError) Unwrap() error {
+	return e.Err
+}
+
+// tableFits checks that a table of count entries of the given size, at the given offset, fits within size bytes
+func tableFits(offset, entrySize, count uint64, size int64) bool {
+	return offset <= uint64(size) && entrySize*count <= uint64(size)-offset
+}
+
+// checkHeader checks the ELF header of the data that can be read from r, which is size bytes
+// long, and returns ErrNotELF if it does not start with the ELF magic number, ErrUnsupportedArch
+// for an unknown class or byte order, and ErrTruncated if the header, the program headers or
+// the section headers do not fit within size
+func checkHeader(r io.ReaderAt, size int64) error {
+	ident := make([]byte, elf.EI_NIDENT)
+	n, err := r.ReadAt(ident, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if n < len(elf.ELFMAG) || string(ident[:len(elf.ELFMAG)]) != elf.ELFMAG {
+		return ErrNotELF
+	}
+	if n < elf.EI_NIDENT {
+		return ErrTruncated
+	}
+	var byteOrder binary.ByteOrder
+	switch data := elf.Data(ident[elf.EI_DATA]); data {
+	case elf.ELFDATA2LSB:
+		byteOrder = binary.LittleEndian
+	case elf.ELFDATA2MSB:
+		byteOrder = binary.BigEndian
+	default:
+		return fmt.Errorf("%w: %v", ErrUnsupportedArch, data)
+	}
+	var headerSize int
+	switch class := elf.Class(ident[elf.EI_CLASS]); class {
+	case elf.ELFCLASS32:
+		headerSize = 52
+	case elf.ELFCLASS64:
+		headerSize = 64
+	default:
+		return fmt.Errorf("%w: %v", ErrUnsupportedArch, class)
+	}
+	if int64(headerSize) > size {
+		return ErrTruncated
+	}
+	header := make([]byte, headerSize)
+	if _, err := r.ReadAt(header, 0); errors.Is(err, io.EOF) {
+		return ErrTruncated
+	} else if err != nil {
+		return err
+	}
+	var phoff, shoff uint64
+	var rest []byte // from e_flags, which is followed by the sizes and the numbers of the headers
+	if headerSize == 52 {
+		phoff, shoff = uint64(byteOrder.Uint32(header[28:])), uint64(byteOrder.Uint32(header[32:]))
+		rest = header[36:]
+	} else {
+		phoff, shoff = byteOrder.Uint64(header[32:]), byteOrder.Uint64(header[40:])
+		rest = header[48:]
+	}
+	phentsize, phnum := uint64(byteOrder.Uint16(rest[6:])), uint64(byteOrder.Uint16(rest[8:]))
+	shentsize, shnum := uint64(byteOrder.Uint16(rest[10:])), uint64(byteOrder.Uint16(rest[12:]))
+	if phnum > 0 && !tableFits(phoff, phentsize, phnum, size) {
+		return ErrTruncated
+	}
+	// With more than 0xff00 sections, e_shnum is 0, and the number is in the first section header
+	if shoff > 0 && !tableFits(shoff, shentsize, max(shnum, 1), size) {
+		return ErrTruncated
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package detect
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Options are the options for examining an ELF file
+type Options struct {
+	Registry *Registry // the detectors to try, or nil for the default registry
+	Explain  bool      // try all detectors, and include what the other detectors found as alternatives
+}
+
+// detect tries the detectors of the options on the given ELF file
+func (opts *Options) detect(ctx context.Context, r io.ReaderAt, f *elf.File) (Detection, error) {
+	reg := opts.Registry
+	if reg == nil {
+		reg = Default
+	}
+	if opts.Explain {
+		return reg.DetectAll(ctx, r, f)
+	}
+	return reg.Detect(ctx, r, f)
+}
+
+// NewFile reads the headers of the ELF file that can be read from r, which is size bytes long.
+// Reads beyond size fail, also when r has more data. The errors are ErrNotELF, ErrTruncated or
+// ErrUnsupportedArch when the ELF header shows what is wrong, and wrap ErrCorrupt if debug/elf
+// can not read the headers for another reason.
+func NewFile(r io.ReaderAt, size int64) (*elf.File, error) {
+	sr := io.NewSectionReader(r, 0, size)
+	if err := checkHeader(sr, size); err != nil {
+		return nil, err
+	}
+	f, err := elf.NewFile(sr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+	return f, nil
+}
+
+// DetectContext finds the compiler that the ELF file that can be read from r, which is size
+// bytes long, was built with. The Detection has the confidence and the evidence. When the
+// context is done, the detection stops, and ErrTimedOut or ErrCancelled is returned.
+func DetectContext(ctx context.Context, r io.ReaderAt, size int64, opts Options) (Detection, error) {
+	r = &contextReader{ctx, r}
+	f, err := NewFile(r, size)
+	if err := ContextError(ctx); err != nil {
+		return Detection{}, err
+	}
+	if err != nil {
+		return Detection{}, err
+	}
+	return opts.detect(ctx, io.NewSectionReader(r, 0, size), f)
+}
+
+// DetectReader is the same as DetectContext, without a context
+func DetectReader(r io.ReaderAt, size int64, opts Options) (Detection, error) {
+	return DetectContext(context.Background(), r, size, opts)
+}
+
+// ExamineContext tries to discover which compiler and compiler version the ELF file that can
+// be read from r, which is size bytes long, was built with, like "GCC 13.2.1" or "unknown".
+// When the context is done, the examination stops, and ErrTimedOut or ErrCancelled is returned.
+func ExamineContext(ctx context.Context, r io.ReaderAt, size int64, opts Options) (string, error) {
+	d, err := DetectContext(ctx, r, size, opts)
+	if err != nil {
+		return "", err
+	}
+	return d.String(), nil
+}
+
+// ExamineReader is the same as ExamineContext, without a context
+func ExamineReader(r io.ReaderAt, size int64, opts Options) (string, error) {
+	return ExamineContext(context.Background(), r, size, opts)
+}
+
+// ExamineBytes is the same as ExamineReader, for the given data and the default options
+func ExamineBytes(data []byte) (string, error) {
+	return ExamineReader(bytes.NewReader(data), int64(len(data)), Options{})
+}
+
+// Examine is the same as ExamineReader, for the given file and the default options
+func Examine(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	return ExamineReader(f, fi.Size(), Options{})
+}
+
+// Static checks that PT_DYNAMIC is not in one of the program headers of the given ELF file
+func Static(f *elf.File) bool {
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_DYNAMIC {
+			return false
+		}
+	}
+	return true
+}
+
+// ExamineStaticContext checks if the ELF file that can be read from r, which is size bytes
+// long, is statically linked. When the context is done, ErrTimedOut or ErrCancelled is returned.
+func ExamineStaticContext(ctx context.Context, r io.ReaderAt, size int64) (bool, error) {
+	f, err := NewFile(&contextReader{ctx, r}, size)
+	if err := ContextError(ctx); err != nil {
+		return false, err
+	}
+	if err != nil {
+		return false, err
+	}
+	return Static(f), nil
+}
+
+// ExamineStaticReader is the same as ExamineStaticContext, without a context
+func ExamineStaticReader(r io.ReaderAt, size int64) (bool, error) {
+	return ExamineStaticContext(context.Background(), r, size)
+}
+
+// ExamineStaticBytes is the same as ExamineStaticReader, for the given data
+func ExamineStaticBytes(data []byte) (bool, error) {
+	return ExamineStaticReader(bytes.NewReader(data), int64(len(data)))
+}
+
+// ExamineStatic is the same as ExamineStaticReader, for the given file
+func ExamineStatic(filename string) (bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	return ExamineStaticReader(f, fi.Size())
+}
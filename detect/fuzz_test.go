@@ -0,0 +1,95 @@
+package detect
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// addSeeds adds the ELF files in the testdata directory to the seed corpus,
+// followed by the given values for the other arguments of the fuzz target
+func addSeeds(f *testing.F, args ...any) {
+	filenames, err := filepath.Glob(filepath.Join("testdata", "*.o"))
+	if err != nil || len(filenames) == 0 {
+		f.Fatal("no ELF files in testdata")
+	}
+	for _, filename := range filenames {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(append([]any{data}, args...)...)
+	}
+}
+
+// FuzzExamineBytes checks that any data can be examined without panicking, and that a
+// compiler is returned when there is no error
+func FuzzExamineBytes(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		compiler, err := ExamineBytes(data)
+		if err == nil && compiler == "" {
+			t.Error("no compiler and no error")
+		}
+		if _, err := ExamineStaticBytes(data); err != nil && compiler != "" {
+			t.Errorf("the file could be examined, but not checked for static linking: %v", err)
+		}
+	})
+}
+
+// FuzzDetectors calls each of the detectors in the default registry directly, instead of
+// through the registry, which would hide detectors that panic
+func FuzzDetectors(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		elfFile, err := NewFile(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return
+		}
+		for _, d := range Default.list() {
+			if found, ok := d.Detect(context.Background(), bytes.NewReader(data), elfFile); ok && found.Name == "" {
+				t.Errorf("the %s detector found a compiler without a name", d.Name())
+			}
+		}
+	})
+}
+
+// FuzzStreamReader checks that the second halves of the buffers that are returned are the data,
+// and that each buffer starts with the second half of the previous one
+func FuzzStreamReader(f *testing.F) {
+	f.Add([]byte("rustc version 1.75.0 (82e1608df 2023-12-21)"), uint8(8))
+	f.Add([]byte{}, uint8(2))
+	addSeeds(f, uint8(63))
+	f.Fuzz(func(t *testing.T, data []byte, size uint8) {
+		bufferSize := 2 * (int(size)%64 + 1)
+		sr, err := NewStreamReader(context.Background(), bytes.NewReader(data), bufferSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		half := bufferSize / 2
+		var read, previous []byte
+		for {
+			b, err := sr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(b) < half || len(b) > bufferSize {
+				t.Fatalf("got %d bytes, with a buffer size of %d", len(b), bufferSize)
+			}
+			if previous != nil && !bytes.Equal(b[:half], previous) {
+				t.Fatalf("the buffer starts with %q, not with %q", b[:half], previous)
+			}
+			read = append(read, b[half:]...)
+			previous = bytes.Clone(b[len(b)-half:])
+		}
+		if !bytes.Equal(read, data) {
+			t.Errorf("read %q, want %q", read, data)
+		}
+	})
+}
@@ -0,0 +1,237 @@
+package detect
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"embed"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// builtinRuleFiles are the detectors that can be described with rules instead of code
+//
+//go:embed rules/*.json
+var builtinRuleFiles embed.FS
+
+// signatureRule describes how a compiler can be recognized, in a JSON rule file.
+// All of the given conditions must hold for the compiler to be detected.
+type signatureRule struct {
+	Name              string   `json:"name"`              // the name of the detector, for --detectors
+	Compiler          string   `json:"compiler"`          // the name of the compiler, like "TCC"
+	Priority          int      `json:"priority"`          // rules with a higher priority are tried first
+	Confidence        *float64 `json:"confidence"`        // from 0 to 1, how sure the detection is (0.8 by default)
+	Sections          []string `json:"sections"`          // the sections that markers, patterns and the version are searched for in
+	Markers           []string `json:"markers"`           // strings that must be found in one of the sections
+	Patterns          []string `json:"patterns"`          // regular expressions that must match in one of the sections
+	Version           string   `json:"version"`           // a regular expression with a capture group for the version
+	RequiredSections  []string `json:"requiredSections"`  // sections that must be present
+	ForbiddenSections []string `json:"forbiddenSections"` // sections that must not be present
+	Symbols           []string `json:"symbols"`           // regular expressions that must each match a symbol name
+
+	patterns []*regexp.Regexp
+	version  *regexp.Regexp
+	symbols  []*regexp.Regexp
+}
+
+// ParseRule parses and checks a JSON rule, and returns the detector that it describes.
+// source is used in error messages.
+func ParseRule(data []byte, source string) (Detector, error) {
+	rule, err := parseRule(data, source)
+	if err != nil {
+		return nil, err
+	}
+	return signatureDetector{rule}, nil
+}
+
+// parseRule parses and checks a JSON rule
+func parseRule(data []byte, source string) (*signatureRule, error) {
+	var rule signatureRule
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rule); err != nil {
+		return nil, errors.New(source + ": " + err.Error())
+	}
+	switch {
+	case rule.Name == "" || rule.Compiler == "":
+		return nil, errors.New(source + ": a rule needs a name and a compiler")
+	case (len(rule.Markers) > 0 || len(rule.Patterns) > 0 || rule.Version != "") && len(rule.Sections) == 0:
+		return nil, errors.New(source + ": markers, patterns and versions need sections to be searched in")
+	case len(rule.Sections) == 0 && len(rule.RequiredSections) == 0 && len(rule.ForbiddenSections) == 0 && len(rule.Symbols) == 0:
+		return nil, errors.New(source + ": a rule needs at least one condition")
+	}
+	compile := func(expr string) (*regexp.Regexp, error) {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.New(source + ": " + err.Error())
+		}
+		return re, nil
+	}
+	// Markers are matched as patterns that match only the marker itself
+	for _, marker := range rule.Markers {
+		rule.patterns = append(rule.patterns, regexp.MustCompile(regexp.QuoteMeta(marker)))
+	}
+	for _, expr := range rule.Patterns {
+		re, err := compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		rule.patterns = append(rule.patterns, re)
+	}
+	for _, expr := range rule.Symbols {
+		re, err := compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		rule.symbols = append(rule.symbols, re)
+	}
+	if rule.Version != "" {
+		re, err := compile(rule.Version)
+		if err != nil {
+			return nil, err
+		}
+		if re.NumSubexp() == 0 {
+			return nil, errors.New(source + ": the version needs a capture group")
+		}
+		rule.version = re
+	}
+	return &rule, nil
+}
+
+// signatureDetector is the detector that a rule describes. Rules have a Name field,
+// so the methods can not be on signatureRule itself.
+type signatureDetector struct {
+	*signatureRule
+}
+
+func (d signatureDetector) Name() string  { return d.signatureRule.Name }
+func (d signatureDetector) Priority() int { return d.signatureRule.Priority }
+
+func (d signatureDetector) Detect(ctx context.Context, r io.ReaderAt, f *elf.File) (Detection, bool) {
+	return d.detect(ctx, r, f)
+}
+
+// detect checks the conditions of the rule, from the cheapest to the most expensive one,
+// and keeps what was found for each condition as evidence
+func (rule *signatureRule) detect(ctx context.Context, r io.ReaderAt, f *elf.File) (Detection, bool) {
+	d := Detection{Name: rule.Compiler, Detector: rule.Name, Confidence: 0.8}
+	if rule.Confidence != nil {
+		d.Confidence = *rule.Confidence
+	}
+	for _, name := range rule.RequiredSections {
+		if f.Section(name) == nil {
+			return Detection{}, false
+		}
+		d.Evidence = append(d.Evidence, sectionEvidence(f, rule.Name, name))
+	}
+	for _, name := range rule.ForbiddenSections {
+		if f.Section(name) != nil {
+			return Detection{}, false
+		}
+		d.Evidence = append(d.Evidence, sectionEvidence(f, rule.Name, name))
+	}
+	if len(rule.symbols) > 0 {
+		symbols, _ := f.Symbols()
+		dynamicSymbols, _ := f.DynamicSymbols()
+		symbols = append(symbols, dynamicSymbols...)
+	nextPattern:
+		for _, re := range rule.symbols {
+			for _, sym := range symbols {
+				if re.MatchString(sym.Name) {
+					d.Evidence = append(d.Evidence, Evidence{Detector: rule.Name, Offset: -1, Match: "has the symbol " + sym.Name})
+					continue nextPattern
+				}
+			}
+			return Detection{}, false
+		}
+	}
+	type section struct {
+		name string
+		data []byte
+	}
+	var contents []section
+	for _, name := range rule.Sections {
+		if ctx.Err() != nil {
+			return Detection{}, false
+		}
+		sec := DebugSection(f, name)
+		if sec == nil {
+			continue
+		}
+		if data, err := ReadSection(r, f, sec); err == nil {
+			contents = append(contents, section{sec.Name, data})
+		}
+	}
+	// find adds the first match of the given regular expression in the sections as evidence,
+	// and returns the submatches
+	find := func(re *regexp.Regexp) ([][]byte, bool) {
+		for _, sec := range contents {
+			if m := re.FindSubmatchIndex(sec.data); m != nil {
+				end := min(m[1], m[0]+maxEvidenceLength)
+				d.Evidence = append(d.Evidence, Evidence{Detector: rule.Name, Section: sec.name, Offset: int64(m[0]), Match: string(sec.data[m[0]:end])})
+				submatches := make([][]byte, len(m)/2)
+				for i := range submatches {
+					if m[2*i] >= 0 {
+						submatches[i] = sec.data[m[2*i]:m[2*i+1]]
+					}
+				}
+				return submatches, true
+			}
+		}
+		return nil, false
+	}
+	for _, re := range rule.patterns {
+		if _, ok := find(re); !ok {
+			return Detection{}, false
+		}
+	}
+	if rule.version != nil {
+		submatches, ok := find(rule.version)
+		if !ok {
+			return Detection{}, false
+		}
+		if i := rule.version.SubexpIndex("version"); i != -1 {
+			d.Version = string(submatches[i])
+		} else {
+			d.Version = string(submatches[1])
+		}
+	}
+	return d, true
+}
+
+// LoadRules reads the rules from the *.json files in the given file system, in order, and
+// returns the detectors that they describe. dir is where the files are, for error messages.
+func LoadRules(fsys fs.FS, dir string) ([]Detector, error) {
+	filenames, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(filenames)
+	var rules []Detector
+	for _, filename := range filenames {
+		data, err := fs.ReadFile(fsys, filename)
+		if err != nil {
+			return nil, err
+		}
+		rule, err := parseRule(data, filepath.Join(dir, filename))
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, signatureDetector{rule})
+	}
+	return rules, nil
+}
+
+// builtinRules returns the detectors that are described by the embedded rules
+func builtinRules() ([]Detector, error) {
+	builtin, err := fs.Sub(builtinRuleFiles, "rules")
+	if err != nil {
+		return nil, err
+	}
+	return LoadRules(builtin, "rules")
+}
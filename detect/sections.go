@@ -0,0 +1,147 @@
+package detect
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	rustMarker       = "rustc version"
+	zdebugMagic      = "ZLIB"
+	elfCompressZlib  = 1
+	elfCompressZstd  = 2
+	chdr32Size       = 12
+	chdr64Size       = 24
+	zdebugHeaderSize = 12
+
+	// MaxSectionSize is the largest section that is read into memory, after decompression
+	MaxSectionSize = 256 * 1024 * 1024
+)
+
+// OpenSection returns a reader for the contents of the given section, where r is
+// what the ELF file is read from. Sections with the SHF_COMPRESSED flag (zlib or zstd)
+// and legacy .zdebug_* sections (zlib) are decompressed, regardless of which
+// compression types the debug/elf package of the current Go version supports.
+func OpenSection(r io.ReaderAt, f *elf.File, sec *elf.Section) (io.ReadCloser, error) {
+	raw := io.NewSectionReader(r, int64(sec.Offset), int64(sec.FileSize))
+	if sec.Type == elf.SHT_NOBITS {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	if sec.Flags&elf.SHF_COMPRESSED != 0 {
+		var (
+			compressionType uint32
+			headerSize      int64
+		)
+		switch f.Class {
+		case elf.ELFCLASS32:
+			header := make([]byte, chdr32Size)
+			if _, err := raw.ReadAt(header, 0); err != nil {
+				return nil, &SectionError{sec.Name, errors.New("truncated compression header")}
+			}
+			compressionType = f.ByteOrder.Uint32(header)
+			headerSize = chdr32Size
+		case elf.ELFCLASS64:
+			header := make([]byte, chdr64Size)
+			if _, err := raw.ReadAt(header, 0); err != nil {
+				return nil, &SectionError{sec.Name, errors.New("truncated compression header")}
+			}
+			compressionType = f.ByteOrder.Uint32(header)
+			headerSize = chdr64Size
+		default:
+			return nil, &SectionError{sec.Name, ErrUnsupportedArch}
+		}
+		compressed := io.NewSectionReader(raw, headerSize, int64(sec.FileSize)-headerSize)
+		switch compressionType {
+		case elfCompressZlib:
+			return zlib.NewReader(compressed)
+		case elfCompressZstd:
+			zr, err := zstd.NewReader(compressed, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return zr.IOReadCloser(), nil
+		}
+		return nil, &SectionError{sec.Name, errors.New("unsupported compression type " + strconv.FormatUint(uint64(compressionType), 10))}
+	}
+	if strings.HasPrefix(sec.Name, ".zdebug_") {
+		// "ZLIB", followed by the uncompressed size as a 64-bit big endian number
+		header := make([]byte, zdebugHeaderSize)
+		if _, err := raw.ReadAt(header, 0); err != nil || string(header[:4]) != zdebugMagic {
+			return nil, &SectionError{sec.Name, errors.New("missing ZLIB header")}
+		}
+		if binary.BigEndian.Uint64(header[4:]) > MaxSectionSize {
+			return nil, &SectionError{sec.Name, errors.New("the uncompressed size is too large")}
+		}
+		return zlib.NewReader(io.NewSectionReader(raw, zdebugHeaderSize, int64(sec.FileSize)-zdebugHeaderSize))
+	}
+	return io.NopCloser(raw), nil
+}
+
+// ReadSection reads the contents of the given section with OpenSection, where r is what the
+// ELF file is read from. Sections that are larger than MaxSectionSize are not read, since
+// the sizes in the headers of crafted ELF files can not be trusted.
+func ReadSection(r io.ReaderAt, f *elf.File, sec *elf.Section) ([]byte, error) {
+	if sec.Type != elf.SHT_NOBITS && sec.FileSize > MaxSectionSize {
+		return nil, &SectionError{sec.Name, errors.New("the section is too large")}
+	}
+	sr, err := OpenSection(r, f, sec)
+	if err != nil {
+		return nil, err
+	}
+	defer sr.Close()
+	data, err := io.ReadAll(io.LimitReader(sr, MaxSectionSize+1))
+	if err != nil {
+		return nil, &SectionError{sec.Name, err}
+	}
+	if len(data) > MaxSectionSize {
+		return nil, &SectionError{sec.Name, errors.New("the uncompressed section is too large")}
+	}
+	return data, nil
+}
+
+// DebugSection returns the section with the given name, for example ".debug_str",
+// or the legacy compressed variant of it, for example ".zdebug_str".
+func DebugSection(f *elf.File, name string) *elf.Section {
+	if sec := f.Section(name); sec != nil {
+		return sec
+	}
+	return f.Section(".z" + strings.TrimPrefix(name, "."))
+}
+
+// rustVerCompressed returns the Rust compiler version or an empty string, by
+// searching a compressed .debug_str or .zdebug_str section, which
+// the debug/elf package does not handle consistently across Go versions.
+// Example output: "Rust 1.27.0"
+func rustVerCompressed(ctx context.Context, r io.ReaderAt, f *elf.File) string {
+	sec := DebugSection(f, ".debug_str")
+	if sec == nil || (sec.Flags&elf.SHF_COMPRESSED == 0 && !strings.HasPrefix(sec.Name, ".zdebug_")) {
+		return ""
+	}
+	sr, err := OpenSection(r, f, sec)
+	if err != nil {
+		return ""
+	}
+	defer sr.Close()
+	stream, err := NewStreamReader(ctx, sr, streamBufferSize)
+	if err != nil {
+		return ""
+	}
+	for {
+		b, err := stream.Next()
+		if err != nil {
+			return ""
+		}
+		if ver, done := rustMarkerVersion(b); done {
+			return ver
+		}
+	}
+}
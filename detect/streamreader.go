@@ -0,0 +1,77 @@
+package detect
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Errors for examinations that were stopped because the context was done,
+// which can be told apart with errors.Is
+var (
+	ErrTimedOut  = errors.New("timed out")
+	ErrCancelled = errors.New("cancelled")
+)
+
+// ContextError returns ErrTimedOut if the deadline of the given context was exceeded,
+// ErrCancelled if the context was cancelled, or nil if it is not done
+func ContextError(ctx context.Context) error {
+	switch err := ctx.Err(); {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrTimedOut
+	}
+	return ErrCancelled
+}
+
+// StreamReader is for searching data in a streaming manner, half a buffer at a time,
+// so that a string that is split between two reads is still found. It is like the
+// StreamReader in ainur, but stops when the context is done.
+type StreamReader struct {
+	ctx context.Context
+	buf []byte
+	r   io.Reader
+}
+
+// NewStreamReader returns a StreamReader for r, with the given buffer size, which must be even
+func NewStreamReader(ctx context.Context, r io.Reader, bufferSize int) (*StreamReader, error) {
+	if bufferSize%2 != 0 {
+		return nil, errors.New("buffer size must be even")
+	}
+	return &StreamReader{ctx: ctx, buf: make([]byte, bufferSize), r: r}, nil
+}
+
+// Next reads the next half buffer from the stream, and returns it after the previous half.
+// io.EOF is returned at the end of the stream, and ErrTimedOut or ErrCancelled when the
+// context is done.
+func (sr *StreamReader) Next() ([]byte, error) {
+	if err := ContextError(sr.ctx); err != nil {
+		return nil, err
+	}
+	half := len(sr.buf) / 2
+	copy(sr.buf, sr.buf[half:])
+	n, err := io.ReadFull(sr.r, sr.buf[half:])
+	if err == io.ErrUnexpectedEOF {
+		return sr.buf[:half+n], nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sr.buf[:half+n], nil
+}
+
+// contextReader is an io.ReaderAt that fails when the context is done, so that
+// the sections that the detectors read can not be read after that
+type contextReader struct {
+	ctx context.Context
+	r   io.ReaderAt
+}
+
+// ReadAt reads from the underlying io.ReaderAt, unless the context is done
+func (cr *contextReader) ReadAt(p []byte, off int64) (int, error) {
+	if err := ContextError(cr.ctx); err != nil {
+		return 0, err
+	}
+	return cr.r.ReadAt(p, off)
+}
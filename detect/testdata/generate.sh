@@ -0,0 +1,38 @@
+#!/bin/sh
+# Regenerate the small ELF object files that the tests and the fuzz targets start from.
+# Each file has the sections that one of the detectors looks for, added with objcopy,
+# so that no other compilers are needed.
+set -e
+cd "$(dirname "$0")"
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+echo 'int main(void) { return 0; }' > "$tmp/main.c"
+gcc -Os -c -o "$tmp/main.o" "$tmp/main.c"
+printf 'GCC: (GNU) 12.2.0\0' > "$tmp/gcc"
+printf 'GCC: (GNU) 12.2.0\0clang version 16.0.6 \0' > "$tmp/clang"
+printf 'GHC 9.4.7\0' > "$tmp/ghc"
+printf 'runtime\0go1.22.5\0' > "$tmp/go"
+printf 'caml_startup\0[ocaml] 4.14.1\0' > "$tmp/ocaml"
+printf 'clang LLVM (rustc version 1.75.0 (82e1608df 2023-12-21))\0' > "$tmp/rust"
+printf 'library/std/src/rt.rs\0/rustc-1.75.0\0' > "$tmp/rust-stripped"
+printf 'FPC 3.2.2 [2021/05/16] for x86_64 - Linux\0' > "$tmp/pascal"
+printf '\0_d_run_main\0__dmd_personality_v0\0' > "$tmp/d"
+printf '\0\0\0\0' > "$tmp/cst4"
+# add creates the given file from main.o with the comment section removed, and the given sections added
+add() {
+  out=$1
+  shift
+  objcopy -R .comment -R .note.GNU-stack "$@" "$tmp/main.o" "$out"
+}
+add gcc.o --add-section .comment="$tmp/gcc"
+add clang.o --add-section .comment="$tmp/clang"
+add ghc.o --add-section .comment="$tmp/ghc"
+add go.o --add-section .rodata="$tmp/go"
+add ocaml.o --add-section .rodata="$tmp/ocaml"
+add rust.o --add-section .debug_str="$tmp/rust"
+objcopy --compress-debug-sections=zlib rust.o rust-zlib.o
+add rust-stripped.o --add-section .comment="$tmp/gcc" --add-section .rodata="$tmp/rust-stripped" --add-section .gcc_except_table="$tmp/cst4"
+add pascal.o --update-section .data="$tmp/pascal"
+add d.o --add-section .dynstr="$tmp/d"
+add tcc.o --add-section .rodata.cst4="$tmp/cst4"
+add unknown.o
@@ -0,0 +1,224 @@
+package detect
+
+import (
+	"bytes"
+	"context"
+	"debug/buildinfo"
+	"debug/elf"
+	"io"
+	"strings"
+
+	"github.com/xyproto/ainur"
+)
+
+const (
+	gccMarker   = "GCC: ("
+	gnuEnding   = "GNU) "
+	clangMarker = "clang version"
+	ghcMarker   = "GHC "
+	ocamlMarker = "[ocaml]"
+
+	// streamBufferSize is the buffer size for searching sections with a StreamReader
+	streamBufferSize = 8192
+
+	// streamMargin is how far from the end of the buffer a match must start, so that
+	// the version after it is within the buffer. Matches closer to the end are found
+	// again in the first half of the buffer by the next read.
+	streamMargin = 1024
+)
+
+// searchSection reads the given section with OpenSection and a StreamReader, where r is what
+// the ELF file is read from, and calls found for each buffer, until it returns true. The search
+// stops at the end of the section, after MaxSectionSize bytes, or when the context is done.
+func searchSection(ctx context.Context, r io.ReaderAt, f *elf.File, sec *elf.Section, found func(b []byte) bool) bool {
+	data, err := OpenSection(r, f, sec)
+	if err != nil {
+		return false
+	}
+	defer data.Close()
+	sr, err := NewStreamReader(ctx, io.LimitReader(data, MaxSectionSize), streamBufferSize)
+	if err != nil {
+		return false
+	}
+	for {
+		b, err := sr.Next()
+		if err != nil {
+			return false
+		}
+		if found(b) {
+			return true
+		}
+	}
+}
+
+// goVer returns the Go compiler version or an empty string, like ainur.GoVer. The version
+// is read from the build information if there is any, since the "go1." strings that are
+// searched for in .rodata otherwise may be something else, like "go1.9" in an error message.
+// Example output: "Go 1.8.3"
+func goVer(ctx context.Context, r io.ReaderAt, f *elf.File) (ver string) {
+	if bi, err := buildinfo.Read(r); err == nil {
+		// Like "go1.21.3", "go1.22rc1 X:nocoverageredesign" or "devel go1.23-2b3d6a5 Tue Apr 2 18:39:16 2024 +0000"
+		if fields := strings.Fields(bi.GoVersion); len(fields) > 0 && strings.HasPrefix(fields[0], "go1") {
+			return "Go " + fields[0][len("go"):]
+		}
+	}
+	sec := f.Section(".rodata")
+	if sec == nil {
+		return ""
+	}
+	searchSection(ctx, r, f, sec, func(b []byte) bool {
+		m := ainur.GoVersionRegex.FindIndex(b)
+		if m == nil || streamBufferSize-m[0] < streamMargin {
+			return false
+		}
+		ver = "Go " + string(b[m[0]+2:m[1]])
+		return true
+	})
+	return ver
+}
+
+// ocamlVer returns the OCaml compiler version or an empty string, like ainur.OCamlVer.
+// Example output: "OCaml 4.05.0"
+func ocamlVer(ctx context.Context, r io.ReaderAt, f *elf.File) (ver string) {
+	sec := f.Section(".rodata")
+	if sec == nil {
+		return ""
+	}
+	searchSection(ctx, r, f, sec, func(b []byte) bool {
+		pos := bytes.Index(b, []byte(ocamlMarker))
+		if pos == -1 || streamBufferSize-pos < streamMargin {
+			return false
+		}
+		ver = "OCaml " + string(ainur.OcamlVersionRegex.Find(b))
+		return true
+	})
+	return ver
+}
+
+// rustVerUnstripped returns the Rust compiler version from the .debug_str section, or an
+// empty string, like ainur.RustVerUnstripped.
+// Example output: "Rust 1.27.0"
+func rustVerUnstripped(ctx context.Context, r io.ReaderAt, f *elf.File) (ver string) {
+	sec := f.Section(".debug_str")
+	if sec == nil {
+		return ""
+	}
+	searchSection(ctx, r, f, sec, func(b []byte) (found bool) {
+		ver, found = rustMarkerVersion(b)
+		return found
+	})
+	return ver
+}
+
+// rustMarkerVersion returns the Rust compiler version that follows the "rustc version" marker
+// in the given buffer, like "Rust 1.27.0", and true if the search is done. A marker that is
+// too close to the end of the buffer is skipped, since it is found again by the next read.
+func rustMarkerVersion(b []byte) (string, bool) {
+	pos1 := bytes.Index(b, []byte(rustMarker))
+	if pos1 == -1 || streamBufferSize-pos1 < streamMargin {
+		return "", false
+	}
+	pos1 += len(rustMarker) + 1
+	if pos1 > len(b) {
+		return "", true
+	}
+	pos2 := bytes.Index(b[pos1:], []byte("("))
+	if pos2 == -1 {
+		return "", true
+	}
+	return "Rust " + strings.TrimSpace(string(b[pos1:pos1+pos2])), true
+}
+
+// rustVerStripped returns "Rust", followed by the GCC version that the linker may have added,
+// if a stripped ELF file looks like it was built with the Rust compiler, like
+// ainur.RustVerStripped. Otherwise, an empty string is returned.
+// Example output: "Rust (GCC 8.1.0)"
+func rustVerStripped(ctx context.Context, r io.ReaderAt, f *elf.File) string {
+	if f.Section(".gcc_except_table") == nil {
+		return ""
+	}
+	sec := f.Section(".rodata")
+	if sec == nil {
+		return ""
+	}
+	// The marker in newer stripped executables, or the marker in older ones
+	found := searchSection(ctx, r, f, sec, func(b []byte) bool {
+		return bytes.Contains(b, []byte("/rustc-"))
+	}) || searchSection(ctx, r, f, sec, func(b []byte) bool {
+		pos := bytes.Index(b, []byte("__rust_"))
+		return pos > 0 && b[pos-1] == 0
+	})
+	if !found {
+		return ""
+	}
+	// Rust may use GCC for linking
+	if gccVersion := gccVer(ctx, r, f); gccVersion != "" {
+		return "Rust (" + gccVersion + ")"
+	}
+	return "Rust"
+}
+
+// ghcVer returns the GHC compiler version from the .comment section, or an empty string,
+// like ainur.GHCVer.
+// Example output: "GHC 8.6.2"
+func ghcVer(_ context.Context, r io.ReaderAt, f *elf.File) string {
+	sec := f.Section(".comment")
+	if sec == nil {
+		return ""
+	}
+	data, err := ReadSection(r, f, sec)
+	if err != nil || !bytes.Contains(data, []byte(ghcMarker)) {
+		return ""
+	}
+	if ghcVersion := bytes.TrimSpace(ainur.GHCVersionRegex.Find(data)); len(ghcVersion) > 0 {
+		return "GHC " + string(ghcVersion[len(ghcMarker):])
+	}
+	return ""
+}
+
+// gccVer returns the GCC or Clang compiler version from the .comment section, like ainur.GCCVer.
+// If the section has no GCC marker, the contents of the section are returned, and if there is
+// no .comment section, an empty string is returned.
+// Example output: "GCC 6.3.1"
+func gccVer(_ context.Context, r io.ReaderAt, f *elf.File) string {
+	sec := f.Section(".comment")
+	if sec == nil {
+		return ""
+	}
+	data, err := ReadSection(r, f, sec)
+	if err != nil {
+		return ""
+	}
+	if !bytes.Contains(data, []byte(gccMarker)) {
+		return string(data)
+	}
+	if bytes.Contains(data, []byte(clangMarker)) {
+		return "Clang " + string(bytes.TrimSpace(ainur.GCCVersionRegex0.Find(data)))
+	}
+	// If there are several markers, like "GCC: (GNU) 6.3.0GCC: (GNU) 7.2.0",
+	// use the largest of the first two versions
+	if bytes.Count(data, []byte(gccMarker)) > 1 {
+		elements := bytes.SplitN(data, []byte(gccMarker), 3)
+		versionA := bytes.TrimPrefix(elements[1], []byte(gnuEnding))
+		versionB := bytes.TrimPrefix(elements[2], []byte(gnuEnding))
+		if ainur.FirstIsGreater(string(versionA), string(versionB)) {
+			data = versionA
+		} else {
+			data = versionB
+		}
+	}
+	if gccVersion := bytes.TrimSpace(ainur.GCCVersionRegex1.Find(data)); len(gccVersion) > 0 {
+		return "GCC " + string(gccVersion[2:])
+	}
+	// Versions that start with "1." are something else
+	if gccVersion := bytes.TrimSpace(ainur.GCCVersionRegex2.Find(data)); len(gccVersion) > 0 && !bytes.HasPrefix(gccVersion, []byte("1.")) {
+		return "GCC " + string(gccVersion)
+	}
+	if gccVersion := bytes.TrimSpace(ainur.GCCVersionRegex3.Find(data)); len(gccVersion) > 0 && !bytes.HasPrefix(gccVersion, []byte("1.")) {
+		return "GCC " + string(gccVersion)
+	}
+	if gccVersion := bytes.TrimSpace(ainur.GCCVersionRegex4.Find(data)); len(gccVersion) > 0 {
+		return "GCC " + string(gccVersion[2:])
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"debug/elf"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/cdetect/detect"
+)
+
+// explain makes all detectors be tried, so that the confidence, the evidence and
+// what the other detectors found can be shown, for --explain
+var explainDetections bool
+
+// detectCompiler returns the compiler that the detectors in the default registry find.
+// With --explain, all detectors are tried, and what the other ones found is included.
+func detectCompiler(ctx context.Context, r io.ReaderAt, f *elf.File) (detect.Detection, error) {
+	if explainDetections {
+		return detect.Default.DetectAll(ctx, r, f)
+	}
+	return detect.Default.Detect(ctx, r, f)
+}
+
+// loadRules registers the detectors that are described by the rules in ~/.config/cdetect/rules,
+// if it exists, and the rules in the given directory, if one is given. The embedded rules are
+// already registered. Rules with the same name as an earlier rule or a built-in detector replace it.
+func loadRules(dir string) error {
+	var rules []detect.Detector
+	if configDir, err := os.UserConfigDir(); err == nil {
+		configRules := filepath.Join(configDir, "cdetect", "rules")
+		if fi, err := os.Stat(configRules); err == nil && fi.IsDir() {
+			userRules, err := detect.LoadRules(os.DirFS(configRules), configRules)
+			if err != nil {
+				return err
+			}
+			rules = append(rules, userRules...)
+		}
+	}
+	if dir != "" {
+		dirRules, err := detect.LoadRules(os.DirFS(dir), dir)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, dirRules...)
+	}
+	for _, rule := range rules {
+		detect.Register(rule)
+	}
+	return nil
+}
+
+// setupDetectors adds the detectors from the rule files, and the rule files in the given
+// directory, if one is given. Then the detectors that are not in the given comma separated
+// list of names, like "go,rust", are unregistered. A name can be followed by a new priority,
+// like "gcc:100", to try that detector earlier. An empty list keeps all of them.
+func setupDetectors(rulesDir, list string) error {
+	if err := loadRules(rulesDir); err != nil {
+		return err
+	}
+	if list == "" {
+		return nil
+	}
+	keep := make(map[string]bool)
+	for _, entry := range strings.Split(list, ",") {
+		name, priority, hasPriority := strings.Cut(strings.ToLower(strings.TrimSpace(entry)), ":")
+		if name == "" {
+			continue
+		}
+		if !detect.Default.Has(name) {
+			return errors.New("unknown detector: " + name + ", expected one of: " + strings.Join(detect.Default.Names(), ", "))
+		}
+		keep[name] = true
+		if hasPriority {
+			n, err := strconv.Atoi(priority)
+			if err != nil {
+				return errors.New("invalid priority for the " + name + " detector: " + priority)
+			}
+			if err := detect.Default.SetPriority(name, n); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range detect.Default.Names() {
+		if !keep[name] {
+			detect.Default.Unregister(name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/xyproto/cdetect/detect"
+)
+
+// errorKind returns a short name for what kind of error the given error is, for JSON output,
+// like "not-elf" for files of the wrong type, or "corrupt" for files that are damaged
+func errorKind(err error) string {
+	var secErr *detect.SectionError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, detect.ErrNotELF):
+		return "not-elf"
+	case errors.Is(err, detect.ErrUnsupportedArch):
+		return "unsupported-arch"
+	case errors.Is(err, detect.ErrTruncated), errors.Is(err, io.ErrUnexpectedEOF):
+		return "truncated"
+	case errors.Is(err, detect.ErrCorrupt), errors.As(err, &secErr):
+		return "corrupt"
+	case errors.Is(err, detect.ErrTimedOut):
+		return "timed-out"
+	case errors.Is(err, detect.ErrCancelled):
+		return "cancelled"
+	case errors.Is(err, errTooLarge):
+		return "too-large"
+	case errors.Is(err, os.ErrNotExist):
+		return "not-found"
+	case errors.Is(err, os.ErrPermission):
+		return "permission-denied"
+	}
+	return "error"
+}
+
+// errorExitCode returns the exit code for a file that could not be examined because of the given error
+func errorExitCode(err error) int {
+	switch errorKind(err) {
+	case "not-elf", "unsupported-arch":
+		return exitNotELF
+	case "truncated", "corrupt":
+		return exitCorrupt
+	}
+	return exitError
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xyproto/cdetect/detect"
+)
+
+// result is what was found when examining a single ELF file,
+// or a single ELF file inside of an archive or a package
+type result struct {
+	name      string // the name of the archive member or the path within the package, if any
+	group     string // the container image the file is in, if any
+	compiler  string
+	detection *detect.Detection // how the compiler was detected, for ELF files
+	kernel    *kernelInfo       // for Linux kernel images and kernel modules
+	details   *details          // checksums and build provenance
+	findings  []finding         // from --check
+	err       error
+}
+
+// String returns the compiler, or a description of the kernel image or kernel module.
+// For Rust executables built with "cargo auditable", the root crate is included.
+func (res *result) String() string {
+	if res.kernel != nil {
+		return res.kernel.String()
+	}
+	if res.details != nil {
+		if root := rootCrate(res.details.crates); root != nil {
+			return res.compiler + ", built from " + root.Name + " " + root.Version + " and " + strconv.Itoa(len(res.details.crates)-1) + " other crates"
+		}
+	}
+	return res.compiler
+}
+
+// examination is what is shared by everything that is examined within a file, like the
+// members of archives and the files in packages and container images
+type examination struct {
+	ctx             context.Context // the examination stops when it is done
+	root            rootFS          // the root directory that the members of thin archives are looked up in
+	maxDecompressed int64           // how many bytes may be decompressed in total, or 0 for no limit
+	decompressed    int64           // how many bytes have been decompressed so far, at all nesting levels
+	inMemory        int64           // how many bytes of data are held in memory, at all nesting levels
+	checksums       bool            // the checksums of the examined files are needed, for the JSON and SBOM formats
+}
+
+// stopped returns detect.ErrTimedOut or detect.ErrCancelled if the examination should stop
+func (e *examination) stopped() error {
+	return detect.ContextError(e.ctx)
+}
+
+// examineData examines the data that can be read from r, which may be an ELF file,
+// a Linux kernel image, a static library, a package, a container image, a ZIP
+// archive (like .jar, .whl or Android .apk files), a SquashFS image, an AppImage
+// or a core dump. For archives, packages, container images and core dumps,
+// there is one result per member, named after the member. For everything else,
+// there is a single result without a name. dir is the directory within the root
+// directory that relative member paths in thin archives are relative to, or an
+// empty string if the data is not a file, like an upload. depth is how deeply nested
+// within other archives the data is. When the examination stops, the results for the
+// members that were examined are returned, with detect.ErrTimedOut or detect.ErrCancelled.
+func examineData(e *examination, r io.ReaderAt, size int64, dir string, depth int) ([]result, error) {
+	switch {
+	case isDeb(r):
+		return examineDeb(e, r, size, depth)
+	case isArchive(r):
+		return examineArchive(e, r, size, dir)
+	case isRPM(r):
+		return examineRPM(e, r, size, depth)
+	case isZip(r):
+		return examineZip(e, r, size, depth)
+	case isSquashfs(r):
+		return examineSquashfs(e, r, size, depth)
+	case isAppImage(r):
+		return examineAppImage(e, r, size, depth)
+	case isTar(r) && isImageTar(r, size):
+		source, err := tarSource(r, size)
+		if err != nil {
+			return nil, err
+		}
+		return examineImages(e, source, depth)
+	case isTar(r):
+		return examineTar(e, io.NewSectionReader(r, 0, size), depth)
+	case isCore(r):
+		return examineCore(e, r, dir != "")
+	}
+	kernel, err := examineKernel(e, r, size)
+	if err != nil {
+		return nil, err
+	}
+	if kernel != nil {
+		compiler := kernel.compiler
+		if compiler == "" {
+			compiler = "unknown"
+		}
+		res := result{compiler: compiler, kernel: kernel}
+		if res.details, err = examineDetails(e, r, size, compiler); err != nil {
+			return nil, err
+		}
+		if kernel.linker != "" {
+			linker := parseTool(kernel.linker)
+			res.details.linker = &linker
+		}
+		return []result{res}, nil
+	}
+	d, err := detectELF(e.ctx, r, size)
+	if err != nil {
+		return nil, err
+	}
+	res := result{compiler: d.String(), detection: &d}
+	if res.details, err = examineDetails(e, r, size, res.compiler); err != nil {
+		return nil, err
+	}
+	if err := e.stopped(); err != nil {
+		return nil, err
+	}
+	return []result{res}, nil
+}
+
+// examineELF tries to discover which compiler and compiler version the ELF file
+// that can be read from r, which is size bytes long, was compiled with.
+// Executables, shared libraries and relocatable object files are supported.
+func examineELF(r io.ReaderAt, size int64) (string, error) {
+	d, err := detectELF(context.Background(), r, size)
+	if err != nil {
+		return "", err
+	}
+	return d.String(), nil
+}
+
+// detectELF is the same as examineELF, but returns the detection, with the
+// confidence and the evidence that the compiler and compiler version are based on.
+// If a malformed ELF file makes it panic, detect.ErrCorrupt is returned. When the
+// context is done, detect.ErrTimedOut or detect.ErrCancelled is returned.
+func detectELF(ctx context.Context, r io.ReaderAt, size int64) (d detect.Detection, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			d, err = detect.Detection{}, fmt.Errorf("%w: %v", detect.ErrCorrupt, p)
+		}
+	}()
+	f, err := detect.NewFile(r, size)
+	if err != nil {
+		return detect.Detection{}, err
+	}
+	if d, err = detectCompiler(ctx, r, f); err != nil {
+		return detect.Detection{}, err
+	}
+	// The TCC heuristic relies on .note.ABI-tag being absent, but that section
+	// is only added when linking, so it is never present in object files.
+	if f.Type == elf.ET_REL && d.Name == "TCC" {
+		d = detect.Detection{Name: "unknown", Alternatives: append([]detect.Detection{d}, d.Alternatives...)}
+	}
+	if !detect.Default.Has("rust") {
+		return d, nil
+	}
+	// Executables built with "cargo auditable" are Rust executables, even if no Rust
+	// symbols or rustc version could be found, for instance because they are stripped
+	if d.Name != "Go" && d.Name != "OCaml" && d.Name != "GHC" && d.Name != "Rust" {
+		if crates, _ := readAuditable(r, f); len(crates) > 0 {
+			auditable := detect.ParseDetection(auditableCompiler(d.String()))
+			auditable.Detector = "cargo-auditable"
+			auditable.Confidence = 0.9
+			auditable.Evidence = []detect.Evidence{{Detector: auditable.Detector, Section: ".dep-v0", Offset: -1, Match: "has a .dep-v0 section with " + strconv.Itoa(len(crates)) + " crates"}}
+			auditable.Alternatives = append([]detect.Detection{d}, d.Alternatives...)
+			d = auditable
+		}
+	}
+	// Stripped Rust executables still have the rustc commit hash in panic location strings
+	if d.Name == "Rust" && d.Version == "" {
+		if rustVersion := rustVerCommit(ctx, r, f); rustVersion != "" {
+			// The rustc version replaces the GCC version of the linker, which is not the compiler
+			rustc := detect.ParseDetection(rustVersion)
+			d.Version, d.Extra = rustc.Version, rustc.Extra
+			d.Detector = "rustc-commit"
+			d.Confidence = 0.9
+			d.Evidence = append(detect.FindEvidence(r, f, d.Detector, []string{".rodata"}, []string{"/rustc/"}), d.Evidence...)
+		}
+	}
+	if err := detect.ContextError(ctx); err != nil {
+		return detect.Detection{}, err
+	}
+	return d, nil
+}
+
+// examineRegularFile examines the ELF file with the given path within the root directory, which
+// a thin archive or a core dump refers to. Only regular files are opened, so that the file can
+// not be a device or a named pipe that blocks.
+func examineRegularFile(e *examination, memberPath string) (*detect.Detection, *details, error) {
+	hostPath, err := e.root.resolve(memberPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fi, err := os.Stat(hostPath); err != nil {
+		return nil, nil, err
+	} else if !fi.Mode().IsRegular() {
+		return nil, nil, errors.New(memberPath + ": not a regular file")
+	}
+	f, err := os.Open(hostPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, nil, errors.New(memberPath + ": not a regular file")
+	}
+	r := &contextReader{e.ctx, f}
+	d, err := detectELF(e.ctx, r, fi.Size())
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", memberPath, err)
+	}
+	details, err := examineDetails(e, r, fi.Size(), d.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	return &d, details, nil
+}
+
+// examineNamedFile examines the ELF file with the given path on the host, like the executable
+// of a process, a file that is mapped into its memory or a shared library, and names the result
+// after name
+func examineNamedFile(e *examination, name, filename string) result {
+	res := result{name: name}
+	f, err := os.Open(filename)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		res.err = err
+		return res
+	}
+	results, err := examineContext(e, f, fi.Size(), "")
+	switch {
+	case err != nil:
+		res.err = err
+	case len(results) != 1 || results[0].name != "":
+		res.err = errors.New(filename + ": not an ELF file")
+	default:
+		res = results[0]
+		res.name = name
+	}
+	return res
+}
+
+// input is an opened file, or other data. Compressed data is decompressed into memory.
+type input struct {
+	io.ReaderAt
+	size        int64
+	compression string // the compression format, if the data was compressed
+}
+
+// newInput returns the data that can be read from r. If the data is compressed with
+// one of the supported compression formats, it is decompressed into memory.
+func newInput(e *examination, r io.ReaderAt, size int64) (*input, error) {
+	magic := make([]byte, 8)
+	n, _ := r.ReadAt(magic, 0)
+	c := detectCompression(magic[:n])
+	if c == nil {
+		return &input{ReaderAt: r, size: size}, nil
+	}
+	data, err := decompressAll(e, c, io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	return &input{ReaderAt: bytes.NewReader(data), size: int64(len(data)), compression: c.name}, nil
+}
+
+// contextReader is an io.ReaderAt that fails with detect.ErrTimedOut or detect.ErrCancelled
+// when the context is done, so that parsing archives and packages stops too
+type contextReader struct {
+	ctx context.Context
+	r   io.ReaderAt
+}
+
+// ReadAt reads from the underlying io.ReaderAt, unless the context is done
+func (cr *contextReader) ReadAt(p []byte, off int64) (int, error) {
+	if err := detect.ContextError(cr.ctx); err != nil {
+		return 0, err
+	}
+	return cr.r.ReadAt(p, off)
+}
+
+// examineContext is the same as examineData, but compressed data is decompressed first.
+// This is what the functions that take a filename use, and what can be used for data
+// that is not in a file, like uploads or blobs. The examination stops when the context
+// of the examination is done, and the results for the members that were examined by then
+// are returned, with detect.ErrTimedOut or detect.ErrCancelled.
+// If examining the data panics, because of malformed data that is not handled, detect.ErrCorrupt
+// is returned instead of crashing, since the data may be an untrusted upload.
+func examineContext(e *examination, r io.ReaderAt, size int64, dir string) (results []result, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			results, err = nil, fmt.Errorf("%w: %v", detect.ErrCorrupt, p)
+		}
+	}()
+	in, err := newInput(e, &contextReader{e.ctx, r}, size)
+	if err == nil {
+		results, err = examineData(e, &contextReader{e.ctx, in.ReaderAt}, in.size, dir, 0)
+	}
+	// Errors while stopping, like failed reads, are reported as the reason for stopping
+	if stopped := e.stopped(); stopped != nil && err != nil {
+		err = stopped
+	}
+	return results, err
+}
+
+// examineBytes is the same as examineContext, but for the given data, which is not a file.
+// Thin archives can not be examined, since the members would be looked up on the host.
+func examineBytes(e *examination, data []byte) ([]result, error) {
+	return examineContext(e, bytes.NewReader(data), int64(len(data)), "")
+}
+
+// summarize returns a summary of the compilers found in the given results,
+// ordered from the most to the least common. Example: "GCC 8.2.0 (3), Clang 7.0.0 (1)"
+func summarize(results []result) string {
+	counts := make(map[string]int)
+	var compilers []string
+	for _, res := range results {
+		if res.err != nil {
+			continue
+		}
+		if counts[res.compiler] == 0 {
+			compilers = append(compilers, res.compiler)
+		}
+		counts[res.compiler]++
+	}
+	if len(compilers) == 0 {
+		return "no ELF files found"
+	}
+	sort.SliceStable(compilers, func(i, j int) bool {
+		return counts[compilers[i]] > counts[compilers[j]]
+	})
+	var sb strings.Builder
+	for i, compiler := range compilers {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(compiler + " (" + strconv.Itoa(counts[compiler]) + ")")
+	}
+	return sb.String()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestExamineGoBuildInfo checks that the compiler version of a Go executable, which is what
+// --check compares with the advisories, is the version in the build information
+func TestExamineGoBuildInfo(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, results, err := examineFile(&examination{ctx: context.Background()}, exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].details == nil || results[0].details.goBuild == nil {
+		t.Fatalf("expected one result with build information, got %+v", results)
+	}
+	want := "Go " + strings.TrimPrefix(strings.Fields(results[0].details.goBuild.GoVersion)[0], "go")
+	if results[0].compiler != want {
+		t.Errorf("got %q, want %q from the build information", results[0].compiler, want)
+	}
+	advisories, err := parseAdvisories(strings.NewReader("Go <1.13 advisory CVE-0000-0000 older than the build information\n"), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := checkResults(results, advisories); n != 0 {
+		t.Errorf("got %d findings for %s, want none", n, results[0].compiler)
+	}
+}
+
+// testELF returns the smallest ELF file that can be parsed, with no sections, for archive fixtures
+func testELF() []byte {
+	header := elf.Header64{
+		Ident:   [elf.EI_NIDENT]byte{0x7f, 'E', 'L', 'F', byte(elf.ELFCLASS64), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)},
+		Type:    uint16(elf.ET_EXEC),
+		Machine: uint16(elf.EM_X86_64),
+		Version: uint32(elf.EV_CURRENT),
+		Ehsize:  uint16(binary.Size(elf.Header64{})),
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, header)
+	return buf.Bytes()
+}
+
+// resultNames returns the names of the given results, with the errors, if any
+func resultNames(results []result) []string {
+	var names []string
+	for _, res := range results {
+		if res.err != nil {
+			names = append(names, res.name+": "+res.err.Error())
+		} else {
+			names = append(names, res.name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xyproto/cdetect/detect"
+)
+
+// inventoryKey is the set of labels that ELF files are counted by
+type inventoryKey struct {
+	compiler string
+	version  string
+	machine  string
+	static   bool
+}
+
+// inventory is the outcome of scanning the configured directories, or the running processes
+type inventory struct {
+	counts   map[inventoryKey]int
+	errors   int
+	duration time.Duration
+	finished time.Time
+}
+
+// add counts the given results
+func (inv *inventory) add(results []result) {
+	for i := range results {
+		res := &results[i]
+		if res.err != nil {
+			if !errors.Is(res.err, detect.ErrNotELF) {
+				inv.errors++
+			}
+			continue
+		}
+		t := parseTool(res.compiler)
+		key := inventoryKey{compiler: t.name, version: t.version}
+		if res.details != nil {
+			key.machine = res.details.machine
+			key.static = res.details.static
+		}
+		inv.counts[key]++
+	}
+}
+
+// isELFFile checks if the given file starts with the ELF magic number
+func isELFFile(filename string) bool {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	magic := make([]byte, 4)
+	_, err = f.ReadAt(magic, 0)
+	return err == nil && string(magic) == "\x7fELF"
+}
+
+// scanDirectories examines the ELF files in the given directories and their subdirectories.
+// Symlinks are not followed, so that no file is counted twice.
+func scanDirectories(dirs []string) *inventory {
+	start := time.Now()
+	inv := &inventory{counts: make(map[inventoryKey]int)}
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(filename string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if !errors.Is(err, fs.ErrPermission) {
+					inv.errors++
+				}
+				return nil
+			}
+			if !entry.Type().IsRegular() || !isELFFile(filename) {
+				return nil
+			}
+			_, results, err := examineFile(&examination{ctx: context.Background()}, filename)
+			if err != nil {
+				inv.errors++
+				return nil
+			}
+			inv.add(results)
+			return nil
+		})
+	}
+	inv.finished = time.Now()
+	inv.duration = inv.finished.Sub(start)
+	return inv
+}
+
+// scanProcesses examines the executables of the running processes. Processes that
+// exit during the scan, kernel threads and processes that can not be inspected
+// because of missing permissions are skipped.
+func scanProcesses() *inventory {
+	start := time.Now()
+	inv := &inventory{counts: make(map[inventoryKey]int)}
+	pids, err := processIDs()
+	if err != nil {
+		inv.errors++
+	}
+	for _, pid := range pids {
+		_, results, err := examineFile(&examination{ctx: context.Background()}, filepath.Join("/proc", strconv.Itoa(pid), "exe"))
+		switch {
+		case errors.Is(err, os.ErrNotExist), errors.Is(err, os.ErrPermission):
+		case err != nil:
+			inv.errors++
+		default:
+			inv.add(results)
+		}
+	}
+	inv.finished = time.Now()
+	inv.duration = inv.finished.Sub(start)
+	return inv
+}
+
+// exporter scans directories and processes periodically, and serves the latest inventories
+type exporter struct {
+	mutex       sync.Mutex
+	inventories map[string]*inventory // by source, "files" or "processes"
+	scans       map[string]int
+}
+
+// update replaces the inventory for the given source
+func (e *exporter) update(source string, inv *inventory) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.inventories[source] = inv
+	e.scans[source]++
+}
+
+// promLabelValue escapes a label value for the Prometheus text format
+func promLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// handleMetrics writes the inventories in the Prometheus text format
+func (e *exporter) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	var sources []string
+	for source := range e.inventories {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	fmt.Fprintln(w, "# HELP cdetect_binaries The number of ELF files or processes, by compiler, compiler version, machine and linking.")
+	fmt.Fprintln(w, "# TYPE cdetect_binaries gauge")
+	for _, source := range sources {
+		inv := e.inventories[source]
+		keys := make([]inventoryKey, 0, len(inv.counts))
+		for key := range inv.counts {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := keys[i], keys[j]
+			if a.compiler != b.compiler {
+				return a.compiler < b.compiler
+			}
+			if cmp := compareVersions(a.version, b.version); cmp != 0 {
+				return cmp < 0
+			}
+			if a.version != b.version {
+				return a.version < b.version
+			}
+			if a.machine != b.machine {
+				return a.machine < b.machine
+			}
+			return !a.static && b.static
+		})
+		for _, key := range keys {
+			fmt.Fprintf(w, "cdetect_binaries{source=\"%s\",compiler=\"%s\",version=\"%s\",machine=\"%s\",static=\"%t\"} %d\n",
+				source, promLabelValue(key.compiler), promLabelValue(key.version), promLabelValue(key.machine), key.static, inv.counts[key])
+		}
+	}
+	for _, m := range []struct {
+		name, kind, help string
+		value            func(source string, inv *inventory) string
+	}{
+		{"cdetect_scan_errors", "gauge", "The number of files that could not be examined in the latest scan.", func(_ string, inv *inventory) string {
+			return strconv.Itoa(inv.errors)
+		}},
+		{"cdetect_scan_duration_seconds", "gauge", "The duration of the latest scan.", func(_ string, inv *inventory) string {
+			return strconv.FormatFloat(inv.duration.Seconds(), 'f', -1, 64)
+		}},
+		{"cdetect_last_scan_timestamp_seconds", "gauge", "The time when the latest scan finished.", func(_ string, inv *inventory) string {
+			return strconv.FormatInt(inv.finished.Unix(), 10)
+		}},
+		{"cdetect_scans_total", "counter", "The number of scans.", func(source string, _ *inventory) string {
+			return strconv.Itoa(e.scans[source])
+		}},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, source := range sources {
+			fmt.Fprintf(w, "%s{source=\"%s\"} %s\n", m.name, source, m.value(source, e.inventories[source]))
+		}
+	}
+}
+
+// exportInventory parses the command line arguments for "cdetect exporter", and scans the
+// configured directories and processes periodically while serving the metrics
+func exportInventory(args []string) error {
+	var (
+		listen    string
+		interval  time.Duration
+		dirs      []string
+		processes bool
+		rulesDir  string
+		detectors string
+	)
+	flags := flag.NewFlagSet("exporter", flag.ExitOnError)
+	flags.Usage = usage
+	flags.StringVar(&listen, "listen", ":9120", "the address to listen on")
+	flags.DurationVar(&interval, "interval", time.Hour, "the time between scans")
+	flags.Func("dir", "a directory to scan, can be given several times", func(dir string) error {
+		dirs = append(dirs, dir)
+		return nil
+	})
+	flags.BoolVar(&processes, "processes", false, "scan the running processes")
+	flags.StringVar(&detectors, "detectors", "", "only use these compiler detectors")
+	flags.StringVar(&rulesDir, "rules", "", "load compiler detection rules from this directory")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		return errors.New("unexpected argument: " + flags.Arg(0))
+	}
+	if len(dirs) == 0 && !processes {
+		return errors.New("expected at least one --dir DIR, or --processes")
+	}
+	if interval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+	if err := setupDetectors(rulesDir, detectors); err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if fi, err := os.Stat(dir); err != nil {
+			return err
+		} else if !fi.IsDir() {
+			return errors.New(dir + ": not a directory")
+		}
+	}
+
+	e := &exporter{inventories: make(map[string]*inventory), scans: make(map[string]int)}
+	go func() {
+		for {
+			if len(dirs) > 0 {
+				e.update("files", scanDirectories(dirs))
+			}
+			if processes {
+				e.update("processes", scanProcesses())
+			}
+			time.Sleep(interval)
+		}
+	}()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", e.handleMetrics)
+	srv := &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	fmt.Fprintln(os.Stderr, "listening on "+listen)
+	return srv.ListenAndServe()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanDirectories(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "lib", "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range map[string][]byte{
+		"bin/a":       testELF(),
+		"lib/sub/b":   testELF(),
+		"lib/README":  []byte("not an executable"),
+		"lib/broken":  []byte("\x7fELF, but not really"),
+		"lib/sub/c.a": testAr(arMagic, "c.o/", string(testELF())),
+	} {
+		filename := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(filename), 0o755)
+		if err := os.WriteFile(filename, contents, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("a", filepath.Join(dir, "bin", "link")); err != nil {
+		t.Fatal(err)
+	}
+	inv := scanDirectories([]string{filepath.Join(dir, "bin"), filepath.Join(dir, "lib"), filepath.Join(dir, "missing")})
+	total := 0
+	for _, n := range inv.counts {
+		total += n
+	}
+	// The symlink and the files that are not ELF files are not counted, and the
+	// missing directory and the broken ELF file are errors
+	if total != 2 || inv.errors != 2 {
+		t.Errorf("got %d files and %d errors, want 2 files and 2 errors: %+v", total, inv.errors, inv.counts)
+	}
+}
+
+func TestExporterMetrics(t *testing.T) {
+	finished := time.Unix(1700000000, 0)
+	e := &exporter{inventories: make(map[string]*inventory), scans: make(map[string]int)}
+	e.update("files", &inventory{counts: map[inventoryKey]int{
+		{compiler: "GCC", version: "13.2.1", machine: "x86_64"}:              3,
+		{compiler: "GCC", version: "9.4.0", machine: "x86_64", static: true}: 1,
+		{compiler: "Go", version: "1.22.1", machine: "aarch64"}:              2,
+		{compiler: `a "quoted" \ name`, machine: "x86_64"}:                   1,
+	}, errors: 4, duration: 1500 * time.Millisecond, finished: finished})
+	e.update("processes", &inventory{counts: map[inventoryKey]int{}, finished: finished})
+	e.update("processes", &inventory{counts: map[inventoryKey]int{{compiler: "unknown"}: 1}, finished: finished})
+	w := httptest.NewRecorder()
+	e.handleMetrics(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	var got []string
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if line != "" && !strings.HasPrefix(line, "#") {
+			got = append(got, line)
+		}
+	}
+	want := []string{
+		`cdetect_binaries{source="files",compiler="GCC",version="9.4.0",machine="x86_64",static="true"} 1`,
+		`cdetect_binaries{source="files",compiler="GCC",version="13.2.1",machine="x86_64",static="false"} 3`,
+		`cdetect_binaries{source="files",compiler="Go",version="1.22.1",machine="aarch64",static="false"} 2`,
+		`cdetect_binaries{source="files",compiler="a \"quoted\" \\ name",version="",machine="x86_64",static="false"} 1`,
+		`cdetect_binaries{source="processes",compiler="unknown",version="",machine="",static="false"} 1`,
+		`cdetect_scan_errors{source="files"} 4`,
+		`cdetect_scan_errors{source="processes"} 0`,
+		`cdetect_scan_duration_seconds{source="files"} 1.5`,
+		`cdetect_scan_duration_seconds{source="processes"} 0`,
+		`cdetect_last_scan_timestamp_seconds{source="files"} 1700000000`,
+		`cdetect_last_scan_timestamp_seconds{source="processes"} 1700000000`,
+		`cdetect_scans_total{source="files"} 1`,
+		`cdetect_scans_total{source="processes"} 2`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"testing"
+)
+
+// fuzzExamination returns an examination for fuzz targets, where the data that is
+// decompressed is limited, so that compressed inputs can not use up the memory
+func fuzzExamination() *examination {
+	return &examination{ctx: context.Background(), maxDecompressed: 1 << 20}
+}
+
+// FuzzExamineCpio checks that any cpio archive can be examined without panicking
+func FuzzExamineCpio(f *testing.F) {
+	f.Add(testCpio(nil))
+	f.Add(testCpio([]testEntry{{"bin", tar.TypeDir, ""}, {"bin/a", tar.TypeReg, string(testELF())}, {"bin/b", tar.TypeSymlink, "a"}}))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		results, _ := examineCpio(fuzzExamination(), bytes.NewReader(data), 0)
+		for _, res := range results {
+			if res.name == "" {
+				t.Error("a result without a name")
+			}
+		}
+	})
+}
+
+// FuzzRPMHeaderSize checks that the size of an RPM header is never smaller than the header itself
+func FuzzRPMHeaderSize(f *testing.F) {
+	f.Add(testRPMHeader(0, 0), int64(0))
+	f.Add(testRPM(nil), int64(rpmLeadSize))
+	f.Fuzz(func(t *testing.T, data []byte, offset int64) {
+		if offset < 0 {
+			return
+		}
+		if size, err := rpmHeaderSize(bytes.NewReader(data), offset); err == nil && size < 16 {
+			t.Errorf("got a size of %d", size)
+		}
+	})
+}
+
+// FuzzExamineTar checks that any tar archive can be examined without panicking
+func FuzzExamineTar(f *testing.F) {
+	exe := string(testELF())
+	f.Add(testTar(f, nil))
+	f.Add(testTar(f, []testEntry{{"usr/bin/a", tar.TypeReg, exe}, {"usr/bin/b", tar.TypeLink, "usr/bin/a"}}))
+	f.Add(testTar(f, []testEntry{{"a.tar.gz", tar.TypeReg, string(testGzip(f, testTar(f, []testEntry{{"a", tar.TypeReg, exe}})))}}))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		results, _ := examineTar(fuzzExamination(), bytes.NewReader(data), 0)
+		for _, res := range results {
+			if res.name == "" {
+				t.Error("a result without a name")
+			}
+		}
+	})
+}
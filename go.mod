@@ -1,5 +1,10 @@
 module github.com/xyproto/cdetect
 
-go 1.12
+go 1.25
 
-require github.com/xyproto/ainur v1.3.3
+require (
+	github.com/klauspost/compress v1.20.1
+	github.com/pierrec/lz4/v4 v4.1.33
+	github.com/xi2/xz v0.0.0-20171230120015-48954b6210f8
+	github.com/xyproto/ainur v1.3.3
+)
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"io"
+
+	"github.com/xyproto/cdetect/detect"
+)
+
+type jsonTool struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type jsonModule struct {
+	Path    string `json:"path"`
+	Version string `json:"version,omitempty"`
+}
+
+type jsonCrate struct {
+	Name         string   `json:"name"`
+	Version      string   `json:"version"`
+	Source       string   `json:"source"`
+	Kind         string   `json:"kind,omitempty"`
+	Root         bool     `json:"root,omitempty"`
+	Dependencies []string `json:"dependencies,omitempty"` // the names and versions of the dependencies
+}
+
+type jsonEvidence struct {
+	Detector string `json:"detector"`
+	Section  string `json:"section,omitempty"`
+	Offset   *int64 `json:"offset,omitempty"`
+	Match    string `json:"match"`
+}
+
+type jsonDetection struct {
+	Compiler   string         `json:"compiler"`
+	Detector   string         `json:"detector"`
+	Confidence float64        `json:"confidence"`
+	Evidence   []jsonEvidence `json:"evidence,omitempty"`
+}
+
+type jsonResult struct {
+	File         string          `json:"file"`
+	Name         string          `json:"name,omitempty"`
+	Group        string          `json:"group,omitempty"`
+	Compiler     string          `json:"compiler,omitempty"`
+	Description  string          `json:"description,omitempty"`
+	Detector     string          `json:"detector,omitempty"`
+	Confidence   *float64        `json:"confidence,omitempty"`
+	Evidence     []jsonEvidence  `json:"evidence,omitempty"`
+	Alternatives []jsonDetection `json:"alternatives,omitempty"` // what the other detectors found, with --explain
+	SHA256       string          `json:"sha256,omitempty"`
+	Linker       *jsonTool       `json:"linker,omitempty"`
+	Runtimes     []jsonTool      `json:"runtimes,omitempty"`
+	GoModules    []jsonModule    `json:"goModules,omitempty"`
+	Crates       []jsonCrate     `json:"crates,omitempty"`
+	Findings     []jsonFinding   `json:"findings,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	ErrorKind    string          `json:"errorKind,omitempty"` // like "not-elf" or "corrupt", see errorKind
+}
+
+type jsonFinding struct {
+	Rule    string `json:"rule"`
+	ID      string `json:"id"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// newJSONEvidence converts the given evidence to JSON
+func newJSONEvidence(evidence []detect.Evidence) []jsonEvidence {
+	var jes []jsonEvidence
+	for _, e := range evidence {
+		je := jsonEvidence{Detector: e.Detector, Section: e.Section, Match: e.Match}
+		if e.Offset >= 0 {
+			je.Offset = &e.Offset
+		}
+		jes = append(jes, je)
+	}
+	return jes
+}
+
+// newJSONResult converts the given result, from examining the given file, to JSON
+func newJSONResult(filename string, res *result) jsonResult {
+	jr := jsonResult{File: filename, Name: res.name, Group: res.group}
+	if res.err != nil {
+		jr.Error = res.err.Error()
+		jr.ErrorKind = errorKind(res.err)
+		return jr
+	}
+	jr.Compiler = res.compiler
+	for _, fi := range res.findings {
+		jr.Findings = append(jr.Findings, jsonFinding{Rule: fi.rule, ID: fi.id, Level: fi.level, Message: fi.message})
+	}
+	if description := res.String(); description != res.compiler {
+		jr.Description = description
+	}
+	if d := res.detection; d != nil {
+		jr.Detector = d.Detector
+		jr.Confidence = &d.Confidence
+		jr.Evidence = newJSONEvidence(d.Evidence)
+		for _, alt := range d.Alternatives {
+			jr.Alternatives = append(jr.Alternatives, jsonDetection{
+				Compiler:   alt.String(),
+				Detector:   alt.Detector,
+				Confidence: alt.Confidence,
+				Evidence:   newJSONEvidence(alt.Evidence),
+			})
+		}
+	}
+	d := res.details
+	if d == nil {
+		return jr
+	}
+	jr.SHA256 = d.sha256
+	if d.linker != nil {
+		jr.Linker = &jsonTool{Name: d.linker.name, Version: d.linker.version}
+	}
+	for _, runtime := range d.runtimes {
+		jr.Runtimes = append(jr.Runtimes, jsonTool{Name: runtime.name, Version: runtime.version})
+	}
+	if d.goBuild != nil {
+		for _, mod := range d.goBuild.Deps {
+			if mod.Replace != nil {
+				mod = mod.Replace
+			}
+			jr.GoModules = append(jr.GoModules, jsonModule{Path: mod.Path, Version: mod.Version})
+		}
+	}
+	for i := range d.crates {
+		c := &d.crates[i]
+		jr.Crates = append(jr.Crates, jsonCrate{
+			Name:         c.Name,
+			Version:      c.Version,
+			Source:       c.Source,
+			Kind:         c.Kind,
+			Root:         c.Root,
+			Dependencies: crateDependencies(d.crates, c),
+		})
+	}
+	return jr
+}
+
+// writeResultsJSON writes the results of examining the given file as a JSON array
+func writeResultsJSON(w io.Writer, filename string, results []result) error {
+	jrs := make([]jsonResult, 0, len(results))
+	for i := range results {
+		jrs = append(jrs, newJSONResult(filename, &results[i]))
+	}
+	return writeJSON(w, jrs)
+}
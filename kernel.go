@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/xyproto/cdetect/detect"
+)
+
+const (
+	linuxBannerMarker = "Linux version "
+	bzImageMagic      = "HdrS"
+)
+
+// toolchainVersionRegex is a regexp for matching version numbers in the linux_banner string
+var toolchainVersionRegex = regexp.MustCompile(`\d+\.\d+(\.\d+)?`)
+
+// kernelInfo is what was found when examining a Linux kernel image or kernel module
+type kernelInfo struct {
+	version  string // kernel version, for example "6.5.9-arch2-1"
+	compiler string // for example "GCC 13.2.1"
+	linker   string // for example "GNU ld 2.41"
+
+	// Fields from the .modinfo section of kernel modules
+	module     bool
+	vermagic   string
+	srcversion string
+	intree     bool
+	retpoline  bool
+}
+
+// String returns a single line describing the kernel image or kernel module
+// Example output: "Linux 6.5.9-arch2-1, GCC 13.2.1, GNU ld 2.41"
+func (k *kernelInfo) String() string {
+	var sb strings.Builder
+	sb.WriteString("Linux")
+	if k.version != "" {
+		sb.WriteString(" " + k.version)
+	}
+	if k.module {
+		sb.WriteString(" module")
+	}
+	if k.compiler != "" {
+		sb.WriteString(", " + k.compiler)
+	}
+	if k.linker != "" {
+		sb.WriteString(", " + k.linker)
+	}
+	if k.module {
+		var details []string
+		// The vermagic string starts with the kernel version, followed by flags like "SMP preempt"
+		if fields := strings.Fields(k.vermagic); len(fields) > 1 {
+			details = append(details, strings.Join(fields[1:], " "))
+		}
+		if k.srcversion != "" {
+			details = append(details, "srcversion "+k.srcversion)
+		}
+		if k.intree {
+			details = append(details, "in-tree")
+		}
+		if k.retpoline {
+			details = append(details, "retpoline")
+		}
+		if len(details) > 0 {
+			sb.WriteString(" (" + strings.Join(details, ", ") + ")")
+		}
+	}
+	return sb.String()
+}
+
+// splitParens splits s into the groups that are enclosed in top level parentheses
+func splitParens(s string) []string {
+	var (
+		groups []string
+		depth  int
+		start  int
+	)
+	for i, r := range s {
+		switch r {
+		case '(':
+			if depth == 0 {
+				start = i + 1
+			}
+			depth++
+		case ')':
+			if depth == 0 {
+				continue
+			}
+			depth--
+			if depth == 0 {
+				groups = append(groups, s[start:i])
+			}
+		}
+	}
+	return groups
+}
+
+// stripParens removes all text that is enclosed in parentheses
+func stripParens(s string) string {
+	var (
+		sb    strings.Builder
+		depth int
+	)
+	for _, r := range s {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// toolchainName turns a compiler or linker description from the linux_banner
+// string into a name and version, for example "gcc-12 (Debian 12.2.0-14) 12.2.0"
+// becomes "GCC 12.2.0" and "GNU ld (GNU Binutils) 2.41" becomes "GNU ld 2.41".
+func toolchainName(s string) string {
+	s = strings.TrimSpace(stripParens(s))
+	version := toolchainVersionRegex.FindString(s)
+	lower := strings.ToLower(s)
+	switch {
+	case strings.Contains(lower, "clang"):
+		return strings.TrimSpace("Clang " + version)
+	case strings.HasPrefix(lower, "gcc"):
+		return strings.TrimSpace("GCC " + version)
+	}
+	if version == "" {
+		return s
+	}
+	name := s[:strings.Index(s, version)]
+	name = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(name), "version"))
+	return strings.TrimSpace(name + " " + version)
+}
+
+// parseLinuxBanner parses a linux_banner string like
+// "Linux version 6.5.9 (user@host) (gcc (GCC) 13.2.1, GNU ld (GNU Binutils) 2.41) #1 SMP"
+func parseLinuxBanner(banner string) *kernelInfo {
+	var k kernelInfo
+	banner = strings.TrimPrefix(banner, linuxBannerMarker)
+	if fields := strings.Fields(banner); len(fields) > 0 {
+		k.version = fields[0]
+	}
+	// The first group is the user and host that built the kernel, the second one is the toolchain
+	groups := splitParens(banner)
+	if len(groups) < 2 {
+		return &k
+	}
+	toolchain := groups[1]
+	// Split on the first comma that is not within parentheses
+	depth := 0
+	for i, r := range toolchain {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				k.compiler = toolchainName(toolchain[:i])
+				k.linker = toolchainName(toolchain[i+1:])
+				return &k
+			}
+		}
+	}
+	k.compiler = toolchainName(toolchain)
+	return &k
+}
+
+// findLinuxBanner searches the given stream for the linux_banner string, until the context is done
+func findLinuxBanner(ctx context.Context, r io.Reader) (string, error) {
+	bufferSize := 8192
+	sr, err := detect.NewStreamReader(ctx, r, bufferSize)
+	if err != nil {
+		return "", err
+	}
+	for {
+		b, err := sr.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return "", err
+		}
+		for offset := 0; offset < len(b); {
+			pos := bytes.Index(b[offset:], []byte(linuxBannerMarker))
+			if pos == -1 {
+				break
+			}
+			pos += offset
+			offset = pos + len(linuxBannerMarker)
+			rest := b[offset:]
+			// The kernel version comes right after the marker, other strings may contain the marker too
+			if len(rest) == 0 || rest[0] < '0' || rest[0] > '9' {
+				continue
+			}
+			end := bytes.IndexAny(rest, "\n\x00")
+			if end == -1 {
+				// The banner continues in the next buffer
+				break
+			}
+			return linuxBannerMarker + string(rest[:end]), nil
+		}
+	}
+	return "", nil
+}
+
+// isKernelModule checks if the given ELF file is a Linux kernel module
+func isKernelModule(f *elf.File) bool {
+	return f.Type == elf.ET_REL && f.Section(".modinfo") != nil
+}
+
+// isVmlinux checks if the given ELF file is an uncompressed Linux kernel image
+func isVmlinux(f *elf.File) bool {
+	if f.Type != elf.ET_EXEC {
+		return false
+	}
+	for _, name := range []string{".init.setup", "__ksymtab", "__param"} {
+		if f.Section(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// examineKernelModule reads the .modinfo section of a kernel module
+func examineKernelModule(ctx context.Context, r io.ReaderAt, f *elf.File) (*kernelInfo, error) {
+	data, err := detect.ReadSection(r, f, f.Section(".modinfo"))
+	if err != nil {
+		return nil, err
+	}
+	k := &kernelInfo{module: true}
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		key, value, found := strings.Cut(string(entry), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "vermagic":
+			k.vermagic = value
+			if fields := strings.Fields(value); len(fields) > 0 {
+				k.version = fields[0]
+			}
+		case "srcversion":
+			k.srcversion = value
+		case "intree":
+			k.intree = value == "Y"
+		case "retpoline":
+			k.retpoline = value == "Y"
+		}
+	}
+	d, err := detect.Default.Detect(ctx, r, f)
+	if err != nil {
+		return nil, err
+	}
+	if compiler := d.String(); compiler != "unknown" && compiler != "TCC" {
+		k.compiler = compiler
+	}
+	return k, nil
+}
+
+// examineVmlinux searches an uncompressed kernel image for the linux_banner string
+func examineVmlinux(ctx context.Context, r io.ReaderAt, f *elf.File) (*kernelInfo, error) {
+	sec := f.Section(".rodata")
+	if sec == nil {
+		return &kernelInfo{}, nil
+	}
+	rodata, err := detect.OpenSection(r, f, sec)
+	if err != nil {
+		return nil, err
+	}
+	defer rodata.Close()
+	banner, err := findLinuxBanner(ctx, io.LimitReader(rodata, detect.MaxSectionSize))
+	if err != nil {
+		return nil, err
+	}
+	k := parseLinuxBanner(banner)
+	if k.compiler == "" {
+		d, err := detect.Default.Detect(ctx, r, f)
+		if err != nil {
+			return nil, err
+		}
+		if compiler := d.String(); compiler != "unknown" {
+			k.compiler = compiler
+		}
+	}
+	return k, nil
+}
+
+// isBzImage checks if the header of the x86 boot protocol can be found in the given file
+func isBzImage(r io.ReaderAt) bool {
+	magic := make([]byte, len(bzImageMagic))
+	if _, err := r.ReadAt(magic, 0x202); err != nil {
+		return false
+	}
+	return string(magic) == bzImageMagic
+}
+
+// examineBzImage decompresses the payload of a bzImage file and searches it
+// for the linux_banner string. Payloads compressed with gzip, xz, zstd, lz4
+// and bzip2 are supported. What is decompressed counts against the limit of the examination.
+func examineBzImage(e *examination, r io.ReaderAt, size int64) (*kernelInfo, error) {
+	header := make([]byte, 0x250)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, errors.New("truncated bzImage header")
+	}
+	setupSects := int64(header[0x1f1])
+	if setupSects == 0 {
+		setupSects = 4
+	}
+	protocol := binary.LittleEndian.Uint16(header[0x206:])
+
+	var payload *io.SectionReader
+	if protocol >= 0x208 {
+		// The payload offset is relative to the start of the protected mode code
+		payloadOffset := int64(binary.LittleEndian.Uint32(header[0x248:]))
+		payloadLength := int64(binary.LittleEndian.Uint32(header[0x24c:]))
+		start := (setupSects+1)*512 + payloadOffset
+		if start+payloadLength <= size {
+			payload = io.NewSectionReader(r, start, payloadLength)
+		}
+	}
+	if payload == nil {
+		// Older boot protocol, search for the start of the compressed data
+		// within the first megabyte after the setup code
+		searchStart := (setupSects + 1) * 512
+		searchSize := size - searchStart
+		if searchSize > 1024*1024 {
+			searchSize = 1024 * 1024
+		}
+		if searchSize <= 0 {
+			return nil, errors.New("truncated bzImage")
+		}
+		data := make([]byte, searchSize)
+		if _, err := r.ReadAt(data, searchStart); err != nil {
+			return nil, err
+		}
+		pos, _ := indexCompression(data)
+		if pos == -1 {
+			return nil, errors.New("could not find the compressed kernel in the bzImage")
+		}
+		start := searchStart + int64(pos)
+		payload = io.NewSectionReader(r, start, size-start)
+	}
+
+	magic := make([]byte, 8)
+	if _, err := payload.ReadAt(magic, 0); err != nil {
+		return nil, errors.New("truncated bzImage payload")
+	}
+	c := detectCompression(magic)
+	if c == nil {
+		return nil, errors.New("unsupported bzImage payload compression")
+	}
+	decompressed, err := e.decompress(c, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer decompressed.Close()
+	banner, err := findLinuxBanner(e.ctx, decompressed)
+	if err != nil {
+		return nil, fmt.Errorf("could not decompress the %s bzImage payload: %w", c.name, err)
+	}
+	if banner == "" {
+		return nil, errors.New("could not find the Linux version in the bzImage payload")
+	}
+	return parseLinuxBanner(banner), nil
+}
+
+// examineKernel examines the given data if it is a Linux kernel module, an
+// uncompressed kernel image (vmlinux) or a compressed kernel image (bzImage).
+// Returns nil and no error if the data is none of these.
+func examineKernel(e *examination, r io.ReaderAt, size int64) (*kernelInfo, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		if isBzImage(r) {
+			return examineBzImage(e, r, size)
+		}
+		return nil, nil
+	}
+	switch {
+	case isKernelModule(f):
+		return examineKernelModule(e.ctx, r, f)
+	case isVmlinux(f):
+		return examineVmlinux(e.ctx, r, f)
+	}
+	return nil, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseLinuxBanner(t *testing.T) {
+	for _, tc := range []struct {
+		banner string
+		want   kernelInfo
+	}{
+		{
+			"Linux version 6.5.9-arch2-1 (linux@archlinux) (gcc (GCC) 13.2.1 20230801, GNU ld (GNU Binutils) 2.41.0) #1 SMP PREEMPT_DYNAMIC",
+			kernelInfo{version: "6.5.9-arch2-1", compiler: "GCC 13.2.1", linker: "GNU ld 2.41.0"},
+		},
+		{
+			"Linux version 6.1.0-13-amd64 (debian-kernel@lists.debian.org) (gcc-12 (Debian 12.2.0-14) 12.2.0, GNU ld (GNU Binutils for Debian) 2.40) #1 SMP",
+			kernelInfo{version: "6.1.0-13-amd64", compiler: "GCC 12.2.0", linker: "GNU ld 2.40"},
+		},
+		{
+			"Linux version 6.6.8 (builder@host) (Android (10087095, +pgo, +bolt, +lto, -mlgo, based on r487747c) clang version 17.0.2, LLD 17.0.2) #1",
+			kernelInfo{version: "6.6.8", compiler: "Clang 17.0.2", linker: "LLD 17.0.2"},
+		},
+		{
+			"Linux version 4.19.0 (root@host) (gcc version 8.3.0 (Debian 8.3.0-6)) #1 SMP",
+			kernelInfo{version: "4.19.0", compiler: "GCC 8.3.0"},
+		},
+		{
+			"Linux version 2.6.32 (root@host) #1 SMP",
+			kernelInfo{version: "2.6.32"},
+		},
+		{
+			"Linux version ",
+			kernelInfo{},
+		},
+	} {
+		if got := parseLinuxBanner(tc.banner); !reflect.DeepEqual(*got, tc.want) {
+			t.Errorf("%q: got %+v, want %+v", tc.banner, *got, tc.want)
+		}
+	}
+}
+
+// testBzImage returns a bzImage with a gzip compressed payload that has the given
+// number of zero bytes before the linux_banner string
+func testBzImage(t *testing.T, padding int) []byte {
+	t.Helper()
+	var payload bytes.Buffer
+	zw := gzip.NewWriter(&payload)
+	zw.Write(make([]byte, padding))
+	zw.Write([]byte("Linux version 6.1.0 (user@host) (gcc (GCC) 12.2.0, GNU ld (GNU Binutils) 2.40) #1 SMP\n\x00"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	const setupSects = 1
+	image := make([]byte, (setupSects+1)*512)
+	image[0x1f1] = setupSects
+	copy(image[0x202:], bzImageMagic)
+	binary.LittleEndian.PutUint16(image[0x206:], 0x20f)
+	binary.LittleEndian.PutUint32(image[0x248:], 0)
+	binary.LittleEndian.PutUint32(image[0x24c:], uint32(payload.Len()))
+	return append(image, payload.Bytes()...)
+}
+
+func TestExamineBzImage(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		padding         int
+		maxDecompressed int64
+		tooLarge        bool
+	}{
+		{"no limit", 1 << 20, 0, false},
+		{"within the limit", 1 << 20, 2 << 20, false},
+		{"above the limit", 1 << 20, 1 << 16, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			image := testBzImage(t, tc.padding)
+			e := &examination{ctx: context.Background(), maxDecompressed: tc.maxDecompressed}
+			k, err := examineKernel(e, bytes.NewReader(image), int64(len(image)))
+			if tc.tooLarge {
+				if !errors.Is(err, errTooLarge) {
+					t.Fatalf("got %v, want %v", err, errTooLarge)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := k.String(), "Linux 6.1.0, GCC 12.2.0, GNU ld 2.40"; got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -2,67 +2,524 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"path"
+	"strconv"
 	"strings"
-
-	"github.com/xyproto/ainur"
+	"time"
 )
 
 const versionString = "cdetect 0.6.0"
 
+// Exit codes, in addition to 0 for success and 2 for invalid command line flags
+const (
+	exitError    = 1 // a file could not be found or examined
+	exitFindings = 3 // --check found problems, or --policy found violations
+	exitNotELF   = 4 // a file is not an ELF file or a supported format, or is for an unsupported ELF class
+	exitCorrupt  = 5 // a file is a truncated or corrupt ELF file
+)
+
+// options are the command line options for how files are examined and reported
+type options struct {
+	format     string
+	check      bool
+	advisories []advisory // for --check
+	policy     []policyRule
+	sarif      *sarifReport  // for --format sarif, where all files are reported at the end
+	labels     bool          // prefix every line of text output with the filename
+	timeout    time.Duration // the time limit per file, if any
+}
+
+// newExamination returns an examination within the given root directory, that stops
+// after --timeout, if it is given
+func (opts *options) newExamination(root rootFS) (*examination, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if opts.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+	}
+	checksums := opts.format == "json" || opts.format == "cyclonedx" || opts.format == "spdx"
+	return &examination{ctx: ctx, root: root, checksums: checksums}, cancel
+}
+
+// checkResults adds findings to the given results, for --check and --policy,
+// and returns the number of findings
+func (opts *options) checkResults(results []result) int {
+	findings := 0
+	if opts.check {
+		findings += checkResults(results, opts.advisories)
+	}
+	if len(opts.policy) > 0 {
+		findings += checkPolicy(results, opts.policy)
+	}
+	return findings
+}
+
 func usage() {
 	fmt.Println(versionString + `
-Detect the compiler version, given an executable (ELF)
+Detect the compiler version, given an executable (ELF),
+an object file, a static library (ar archive),
+a Linux kernel image, a Linux kernel module or a package
+(.deb, .rpm, .pkg.tar.zst or .apk), a container image
+(OCI image layout directory or docker save tarball),
+a ZIP based bundle (.jar, .whl, Android .apk or .aar),
+a SquashFS image, an AppImage or a core dump
+
+The exit code is 0 if no problems were found, 1 if a file could not be
+examined, 3 if --check or --policy found problems, 4 if a file is not an
+ELF file or any of the supported formats, and 5 if a file is truncated or
+corrupt. If files could not be examined for different reasons, it is 1.
 
 Usage:
-    cdetect [OPTION]... [FILE]
+    cdetect [OPTION]... [FILE]...
+    cdetect serve [SERVE OPTION]...
+    cdetect exporter [EXPORTER OPTION]...
 
 Options:
+    --pid N                 - examine the running process N
+    --all-processes         - examine all running processes
+    --deps                  - examine the shared library dependencies of FILE
+    --root DIR              - look up FILE and its dependencies within DIR,
+                              like a mounted image or a sysroot
+    --sysroot DIR           - same as --root
+    --format FORMAT         - the output format: text (the default), json,
+                              cyclonedx or spdx (JSON SBOMs) or sarif
+    --check                 - check for end-of-life compilers and compilers with
+                              known advisories, and exit with 3 if any are found
+    --policy FILE           - check every FILE against the rules in the given
+                              policy file, and exit with 3 if any are violated
+    --detectors LIST        - only use the given compiler detectors, like go,rust
+                              (go, ocaml, ghc, rust, d, gcc, pascal and tcc), and
+                              give a detector a new priority with NAME:PRIORITY
+    --timeout DURATION      - stop examining a file or a process after the given
+                              time, like 30s, and report it as timed out
+    --explain               - show the confidence and the evidence behind every
+                              compiler, and what the other detectors found
+    --rules DIR             - load compiler detection rules (*.json) from DIR, in
+                              addition to ~/.config/cdetect/rules
     -v, --version           - version info
     -h, --help              - this help output
+
+Serve options:
+    --listen ADDRESS        - the address to listen on (127.0.0.1:8080)
+    --timeout DURATION      - the time limit per request (30s)
+    --max-size BYTES        - the largest upload (256 MiB)
+    --max-decompressed BYTES
+                            - how much may be decompressed per request (1 GiB)
+    --concurrency N         - the number of files that can be examined at once
+                              (the number of CPUs)
+    --root DIR              - look up local files within DIR
+    --check, --policy FILE, --detectors LIST, --rules DIR
+                            - as above
+
+    POST /examine           - examine the uploaded file (the request body), or
+                              the local file given with ?path=FILE, and respond
+                              with the same JSON as --format json
+    GET /healthz            - respond with "ok"
+    GET /metrics            - request metrics, in the Prometheus text format
+
+Exporter options:
+    --listen ADDRESS        - the address to listen on (:9120)
+    --dir DIR               - scan the ELF files in DIR and its subdirectories,
+                              can be given several times
+    --processes             - scan the executables of the running processes
+    --interval DURATION     - the time between scans (1h)
+    --detectors LIST, --rules DIR
+                            - as above
+
+    GET /metrics            - the number of ELF files and processes by compiler,
+                              version, machine and linking, and scan metrics,
+                              in the Prometheus text format
 	`)
 }
 
-// Check if the given filename exists.
-// If it exists in $PATH, return the full path,
-// else return an empty string.
-func which(filename string) (string, error) {
-	if _, err := os.Stat(filename); !os.IsNotExist(err) {
-		return filename, nil
+// Check if the given filename exists. Names without a slash are looked up in $PATH,
+// and must be executable. The full path is returned. All lookups, including the
+// resolution of symlinks, happen within the given root directory, if one is given.
+func which(filename string, root rootFS) (string, error) {
+	if strings.Contains(filename, "/") || root.dir == "" {
+		hostPath, err := root.resolve(filename)
+		if err == nil {
+			_, err = os.Stat(hostPath)
+		}
+		switch {
+		case err == nil:
+			return filename, nil
+		case !os.IsNotExist(err):
+			return "", err
+		case strings.Contains(filename, "/"):
+			return "", errors.New(filename + ": no such file or directory")
+		}
 	}
+	var notExecutable []string
 	for _, directory := range strings.Split(os.Getenv("PATH"), ":") {
+		if directory == "" {
+			continue
+		}
 		fullPath := path.Join(directory, filename)
-		if _, err := os.Stat(fullPath); !os.IsNotExist(err) {
+		hostPath, err := root.resolve(fullPath)
+		var fi os.FileInfo
+		if err == nil {
+			fi, err = os.Stat(hostPath)
+		}
+		switch {
+		case os.IsNotExist(err):
+			continue
+		case err != nil:
+			return "", err
+		case isExecutable(fi.Mode()):
 			return fullPath, nil
+		case fi.Mode().IsRegular():
+			notExecutable = append(notExecutable, fullPath)
 		}
 	}
+	if len(notExecutable) > 0 {
+		return "", errors.New(filename + ": found, but not executable: " + strings.Join(notExecutable, ", "))
+	}
 	return "", errors.New(filename + ": no such file or directory")
 }
 
+// examineFile examines the given file, within the root directory of the examination. Compressed
+// files are decompressed first. The path of the file on the host is returned, with the results.
+// The examination stops when its context is done, and then the results that were found
+// until then are returned, with detect.ErrTimedOut or detect.ErrCancelled.
+func examineFile(e *examination, filename string) (string, []result, error) {
+	hostPath, err := e.root.resolve(filename)
+	if err != nil {
+		return "", nil, err
+	}
+	var results []result
+	if fi, err := os.Stat(hostPath); err == nil && fi.IsDir() {
+		if !isImageDir(hostPath) {
+			return "", nil, errors.New(filename + ": is a directory, but not an OCI image layout")
+		}
+		if results, err = examineImages(e, dirSource(hostPath), 0); err != nil {
+			return hostPath, results, fmt.Errorf("%s: %w", filename, err)
+		}
+		return hostPath, results, nil
+	}
+	f, err := os.Open(hostPath)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", nil, err
+	}
+	// Relative member paths in thin archives are looked up next to the archive, within the root directory
+	if results, err = examineContext(e, f, fi.Size(), path.Dir(filename)); err != nil {
+		return hostPath, results, fmt.Errorf("%s: %w", filename, err)
+	}
+	return hostPath, results, nil
+}
+
+// examine examines the given file, within the given root directory, and outputs the results
+// in the given format. Compressed files are decompressed first. The number of findings is returned.
+// If the examination timed out, the results that were found until then are output before the
+// error is returned.
+func examine(filename string, root rootFS, opts *options) (int, error) {
+	e, cancel := opts.newExamination(root)
+	defer cancel()
+	hostPath, results, err := examineFile(e, filename)
+	if err != nil && len(results) == 0 {
+		return 0, err
+	}
+	findings := opts.checkResults(results)
+	if outputErr := output(filename, hostPath, results, opts); outputErr != nil {
+		return findings, outputErr
+	}
+	return findings, err
+}
+
+// output outputs the results for the given file in the given format
+func output(filename, hostPath string, results []result, opts *options) error {
+	switch opts.format {
+	case "sarif":
+		opts.sarif.add(filename, results)
+		return nil
+	case "cyclonedx":
+		return writeCycloneDX(os.Stdout, newSBOM(filename, hostPath, results))
+	case "spdx":
+		return writeSPDX(os.Stdout, newSBOM(filename, hostPath, results))
+	case "json":
+		return writeResultsJSON(os.Stdout, filename, results)
+	}
+	if len(results) == 1 && results[0].name == "" {
+		if opts.labels {
+			fmt.Println(filename + ": " + results[0].String())
+		} else {
+			fmt.Println(results[0].String())
+		}
+		for _, line := range explain(&results[0]) {
+			fmt.Println(filename + ": " + line)
+		}
+		for _, fi := range results[0].findings {
+			fmt.Println(filename + ": " + fi.String())
+		}
+		return nil
+	}
+	report(filename, results)
+	return nil
+}
+
+// explain returns the confidence and the evidence behind the compiler of the given result,
+// and what the other detectors found, one line each, if --explain is given
+func explain(res *result) []string {
+	d := res.detection
+	if !explainDetections || d == nil {
+		return nil
+	}
+	var lines []string
+	if d.Detector == "" {
+		lines = append(lines, "confidence: 0 (no detector found the compiler)")
+	} else {
+		lines = append(lines, "confidence: "+strconv.FormatFloat(d.Confidence, 'f', -1, 64)+" ("+d.Detector+")")
+	}
+	for _, e := range d.Evidence {
+		lines = append(lines, "evidence: "+e.String())
+	}
+	for _, alt := range d.Alternatives {
+		lines = append(lines, "also detected: "+alt.String()+", with confidence "+strconv.FormatFloat(alt.Confidence, 'f', -1, 64)+" ("+alt.Detector+")")
+		for _, e := range alt.Evidence {
+			lines = append(lines, "evidence for "+alt.String()+": "+e.String())
+		}
+	}
+	return lines
+}
+
+// report outputs one line per result, prefixed with the given label and the group
+// of the result, followed by a summary line per group
+func report(label string, results []result) {
+	var groups []string
+	groupResults := make(map[string][]result)
+	for i := range results {
+		res := &results[i]
+		if _, ok := groupResults[res.group]; !ok {
+			groups = append(groups, res.group)
+		}
+		groupResults[res.group] = append(groupResults[res.group], *res)
+		prefix := label
+		if res.group != "" {
+			prefix += "(" + res.group + ")"
+		}
+		if res.err != nil {
+			fmt.Printf("%s(%s): %s\n", prefix, res.name, res.err)
+			continue
+		}
+		fmt.Printf("%s(%s): %s\n", prefix, res.name, res.String())
+		for _, line := range explain(res) {
+			fmt.Printf("%s(%s): %s\n", prefix, res.name, line)
+		}
+		for _, fi := range res.findings {
+			fmt.Printf("%s(%s): %s\n", prefix, res.name, fi.String())
+		}
+	}
+	if len(groups) == 0 {
+		groups = append(groups, "")
+	}
+	for _, group := range groups {
+		prefix := label
+		if group != "" {
+			prefix += "(" + group + ")"
+		}
+		fmt.Printf("%s: %s\n", prefix, summarize(groupResults[group]))
+	}
+}
+
 func main() {
-	if len(os.Args) == 2 {
-		switch os.Args[1] {
-		case "-h", "--help":
-			usage()
-		case "-v", "--version":
-			fmt.Println(versionString)
-		default:
-			filepath, err := which(os.Args[1])
+	var (
+		showVersion  bool
+		pid          int
+		allProcesses bool
+		deps         bool
+		rootDir      string
+		policyFile   string
+		detectorList string
+		rulesDir     string
+		opts         options
+	)
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		if err := serve(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "exporter" {
+		if err := exportInventory(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+		return
+	}
+	flag.Usage = usage
+	flag.BoolVar(&showVersion, "v", false, "version info")
+	flag.BoolVar(&showVersion, "version", false, "version info")
+	flag.IntVar(&pid, "pid", 0, "examine a running process")
+	flag.BoolVar(&allProcesses, "all-processes", false, "examine all running processes")
+	flag.BoolVar(&deps, "deps", false, "examine the shared library dependencies")
+	flag.StringVar(&rootDir, "root", "", "look up files within this directory")
+	flag.StringVar(&rootDir, "sysroot", "", "look up files within this directory")
+	flag.StringVar(&opts.format, "format", "text", "the output format")
+	flag.BoolVar(&opts.check, "check", false, "check for end-of-life compilers and known advisories")
+	flag.StringVar(&policyFile, "policy", "", "check files against the rules in this policy file")
+	flag.StringVar(&detectorList, "detectors", "", "only use these compiler detectors")
+	flag.StringVar(&rulesDir, "rules", "", "load compiler detection rules from this directory")
+	flag.DurationVar(&opts.timeout, "timeout", 0, "the time limit per file")
+	flag.BoolVar(&explainDetections, "explain", false, "show the confidence and the evidence for every result")
+	flag.Parse()
+
+	switch opts.format {
+	case "text", "json", "cyclonedx", "spdx":
+	case "sarif":
+		opts.sarif = &sarifReport{}
+	default:
+		fmt.Fprintln(os.Stderr, "unknown output format: "+opts.format)
+		os.Exit(exitError)
+	}
+	if opts.check {
+		var err error
+		if opts.advisories, err = loadAdvisories(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+	}
+
+	if err := setupDetectors(rulesDir, detectorList); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitError)
+	}
+	if policyFile != "" {
+		var err error
+		if opts.policy, err = loadPolicy(policyFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+	}
+	if (flag.NArg() > 1 || allProcesses) && (opts.format == "cyclonedx" || opts.format == "spdx") {
+		fmt.Fprintln(os.Stderr, "only one file or process can be examined with --format "+opts.format)
+		os.Exit(exitError)
+	}
+
+	findings, exitCode := 0, 0
+	// fail records that a file could not be examined, with an exit code for the given error
+	fail := func(err error) {
+		if code := errorExitCode(err); exitCode == 0 {
+			exitCode = code
+		} else if code != exitCode {
+			exitCode = exitError
+		}
+	}
+	// writeSARIF writes the SARIF report for --format sarif, after all files have been examined
+	writeSARIF := func() {
+		if opts.sarif != nil {
+			if err := opts.sarif.write(os.Stdout); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				fail(err)
+			}
+		}
+	}
+	switch {
+	case showVersion:
+		fmt.Println(versionString)
+	case pid > 0:
+		// The process is examined and reported like a file, with the time limit for the whole process
+		label := "pid " + strconv.Itoa(pid)
+		e, cancel := opts.newExamination(rootFS{})
+		results, err := examineProcess(e, pid, make(processCache))
+		cancel()
+		if len(results) > 0 {
+			findings = opts.checkResults(results)
+			if outputErr := output(label, path.Join("/proc", strconv.Itoa(pid), "exe"), results, &opts); outputErr != nil {
+				fmt.Fprintln(os.Stderr, outputErr)
+				fail(outputErr)
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, label+": "+err.Error())
+			if opts.sarif != nil {
+				opts.sarif.addError(label, err)
+			}
+			fail(err)
+		}
+		writeSARIF()
+	case allProcesses:
+		processes, err := examineAllProcesses(func() (*examination, context.CancelFunc) {
+			return opts.newExamination(rootFS{})
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitError)
+		}
+		opts.labels = true
+		var all []result
+		for _, p := range processes {
+			label := "pid " + strconv.Itoa(p.pid)
+			if len(p.results) > 0 {
+				findings += opts.checkResults(p.results)
+				if outputErr := output(label, path.Join("/proc", strconv.Itoa(p.pid), "exe"), p.results, &opts); outputErr != nil {
+					fmt.Fprintln(os.Stderr, outputErr)
+					fail(outputErr)
+				}
+				all = append(all, p.results...)
+			}
+			if p.err != nil {
+				// Processes that can not be inspected are listed, but do not change the exit code
+				if opts.format == "text" {
+					fmt.Println(label + ": " + p.err.Error())
+				} else {
+					fmt.Fprintln(os.Stderr, label+": "+p.err.Error())
+				}
+				if opts.sarif != nil {
+					opts.sarif.addError(label, p.err)
+				}
+			}
+		}
+		if opts.format == "text" {
+			fmt.Println("all processes: " + summarize(all))
+		}
+		writeSARIF()
+	case flag.NArg() > 0:
+		// Continue with the next file if one can not be examined, so that all problems are reported
+		root := rootFS{rootDir}
+		opts.labels = flag.NArg() > 1
+		for _, arg := range flag.Args() {
+			filepath, err := which(arg, root)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
+				if opts.sarif != nil {
+					opts.sarif.addError(arg, err)
+				}
+				fail(err)
+				continue
+			}
+			var n int
+			if deps {
+				n, err = outputDeps(filepath, root, &opts)
+			} else {
+				n, err = examine(filepath, root, &opts)
 			}
-			compilerVersion, err := ainur.Examine(filepath)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
+				if opts.sarif != nil {
+					opts.sarif.addError(filepath, err)
+				}
+				fail(err)
 			}
-			fmt.Println(compilerVersion)
+			findings += n
 		}
-	} else {
+		writeSARIF()
+	default:
 		usage()
 	}
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
+	if findings > 0 {
+		os.Exit(exitFindings)
+	}
 }
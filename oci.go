@@ -0,0 +1,418 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+
+	ociIndexMediaType    = "application/vnd.oci.image.index.v1+json"
+	dockerListMediaType  = "application/vnd.docker.distribution.manifest.list.v2+json"
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+	containerdAnnotation = "io.containerd.image.name"
+)
+
+// imageSource opens a file by its path within an OCI image layout or a docker save tarball
+type imageSource func(name string) (io.ReadCloser, error)
+
+// ociDescriptor is a reference to a blob in an OCI image layout
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// ociIndex is an OCI image index, used both for index.json and for multi-platform images
+type ociIndex struct {
+	MediaType string          `json:"mediaType"`
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+// ociManifest is an OCI image manifest
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Config    ociDescriptor   `json:"config"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+// ociConfig is the part of an OCI image configuration that is used for naming the image
+type ociConfig struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+}
+
+// dockerManifest is an entry in the manifest.json file of a docker save tarball
+type dockerManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// image is a container image, with the paths to the layers within the image source
+type image struct {
+	name   string
+	layers []string
+}
+
+// dirSource returns an imageSource for an image layout that has been extracted to the given directory
+func dirSource(dir string) imageSource {
+	return func(name string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(dir, filepath.FromSlash(path.Clean("/"+name))))
+	}
+}
+
+// tarSource returns an imageSource for an image layout or a docker save tarball,
+// by creating an index of where the files are in the tar archive that can be read from r
+func tarSource(r io.ReaderAt, size int64) (imageSource, error) {
+	type location struct {
+		offset, size int64
+	}
+	index := make(map[string]location)
+	sr := io.NewSectionReader(r, 0, size)
+	tr := tar.NewReader(sr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		// The tar reader is positioned at the start of the file data after reading the header
+		offset, err := sr.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		index[path.Clean(strings.TrimPrefix(header.Name, "./"))] = location{offset, header.Size}
+	}
+	return func(name string) (io.ReadCloser, error) {
+		loc, ok := index[path.Clean(name)]
+		if !ok {
+			return nil, errors.New(name + ": no such file in the image")
+		}
+		return io.NopCloser(io.NewSectionReader(r, loc.offset, loc.size)), nil
+	}, nil
+}
+
+// readJSON reads and decodes the given JSON file from the image source
+func (source imageSource) readJSON(name string, v interface{}) error {
+	f, err := source(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return errors.New(name + ": " + err.Error())
+	}
+	return nil
+}
+
+// exists checks if the given file can be opened from the image source
+func (source imageSource) exists(name string) bool {
+	f, err := source(name)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// blobPath returns the path to the blob with the given digest, like "sha256:abc..."
+func blobPath(digest string) (string, error) {
+	algorithm, hex, found := strings.Cut(digest, ":")
+	if !found || algorithm == "" || hex == "" || strings.ContainsAny(digest, "/\\") {
+		return "", errors.New("invalid digest: " + digest)
+	}
+	return "blobs/" + algorithm + "/" + hex, nil
+}
+
+// isImage checks if the given image source has a docker save manifest.json or an OCI image layout
+func isImage(source imageSource) bool {
+	return source.exists("manifest.json") || (source.exists("oci-layout") && source.exists("index.json"))
+}
+
+// isImageTar checks if the given tar archive is a docker save tarball or an OCI image layout
+func isImageTar(r io.ReaderAt, size int64) bool {
+	source, err := tarSource(r, size)
+	return err == nil && isImage(source)
+}
+
+// isImageDir checks if the given directory contains a docker save tarball or an OCI image layout
+func isImageDir(dir string) bool {
+	return isImage(dirSource(dir))
+}
+
+// ociImages resolves the images in an OCI image layout, following image indexes
+// for multi-platform images
+func ociImages(source imageSource, descriptors []ociDescriptor, name string) ([]image, error) {
+	var images []image
+	for _, descriptor := range descriptors {
+		imageName := name
+		if ref := descriptor.Annotations[containerdAnnotation]; ref != "" {
+			imageName = ref
+		} else if ref := descriptor.Annotations[ociRefNameAnnotation]; ref != "" && imageName == "" {
+			imageName = ref
+		}
+		blob, err := blobPath(descriptor.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if descriptor.MediaType == ociIndexMediaType || descriptor.MediaType == dockerListMediaType {
+			var index ociIndex
+			if err := source.readJSON(blob, &index); err != nil {
+				return nil, err
+			}
+			nested, err := ociImages(source, index.Manifests, imageName)
+			if err != nil {
+				return nil, err
+			}
+			images = append(images, nested...)
+			continue
+		}
+		var manifest ociManifest
+		if err := source.readJSON(blob, &manifest); err != nil {
+			return nil, err
+		}
+		if imageName == "" {
+			imageName = descriptor.Digest
+		}
+		configBlob, err := blobPath(manifest.Config.Digest)
+		if err != nil {
+			return nil, err
+		}
+		var config ociConfig
+		if err := source.readJSON(configBlob, &config); err != nil {
+			return nil, err
+		}
+		if config.OS != "" && config.Architecture != "" {
+			imageName += " " + config.OS + "/" + config.Architecture
+		}
+		img := image{name: imageName}
+		for _, layer := range manifest.Layers {
+			layerBlob, err := blobPath(layer.Digest)
+			if err != nil {
+				return nil, err
+			}
+			img.layers = append(img.layers, layerBlob)
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// resolveImages returns the images in the given docker save tarball or OCI image layout
+func resolveImages(source imageSource) ([]image, error) {
+	if source.exists("manifest.json") {
+		var manifests []dockerManifest
+		if err := source.readJSON("manifest.json", &manifests); err != nil {
+			return nil, err
+		}
+		images := make([]image, 0, len(manifests))
+		for _, manifest := range manifests {
+			name := strings.TrimSuffix(path.Base(manifest.Config), ".json")
+			if len(manifest.RepoTags) > 0 {
+				name = manifest.RepoTags[0]
+			}
+			var config ociConfig
+			if err := source.readJSON(manifest.Config, &config); err != nil {
+				return nil, err
+			}
+			if config.OS != "" && config.Architecture != "" {
+				name += " " + config.OS + "/" + config.Architecture
+			}
+			images = append(images, image{name: name, layers: manifest.Layers})
+		}
+		return images, nil
+	}
+	var index ociIndex
+	if err := source.readJSON("index.json", &index); err != nil {
+		return nil, err
+	}
+	return ociImages(source, index.Manifests, "")
+}
+
+// walkLayer calls f for every entry in the given layer, which may be compressed,
+// until f returns an error
+func walkLayer(e *examination, source imageSource, layer string, f func(header *tar.Header, tr *tar.Reader) error) error {
+	blob, err := source(layer)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	data, err := decompressStream(e, blob)
+	if err != nil {
+		return errors.New(layer + ": " + err.Error())
+	}
+	defer data.Close()
+	tr := tar.NewReader(data)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.New(layer + ": " + err.Error())
+		}
+		if err := f(header, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// layerFile is a regular file entry in a layer, which the contents of a file in the root filesystem come from
+type layerFile struct {
+	layer int
+	name  string
+}
+
+// removeFiles removes the given path, and everything below it if it is a directory, from the root filesystem
+func removeFiles(files map[string]layerFile, name string) {
+	prefix := strings.TrimSuffix(name, "/") + "/"
+	for file := range files {
+		if file == name || strings.HasPrefix(file, prefix) {
+			delete(files, file)
+		}
+	}
+}
+
+// examineImage applies the layers of the given image in order, including whiteouts and hardlinks,
+// and then examines every ELF file in the resulting root filesystem.
+// The layers are read twice, so that the file contents do not have to be kept in memory.
+func examineImage(e *examination, source imageSource, img image, depth int) ([]result, error) {
+	// The entry that each regular file in the root filesystem has its contents from
+	files := make(map[string]layerFile)
+	for i, layer := range img.layers {
+		var (
+			entries   []*tar.Header
+			whiteouts []string
+		)
+		err := walkLayer(e, source, layer, func(header *tar.Header, tr *tar.Reader) error {
+			name := packagePath(header.Name)
+			dir, base := path.Split(name)
+			switch {
+			case base == whiteoutOpaque:
+				// Everything in this directory from the lower layers is hidden
+				whiteouts = append(whiteouts, path.Clean(dir))
+			case strings.HasPrefix(base, whiteoutPrefix):
+				whiteouts = append(whiteouts, path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)))
+			default:
+				entries = append(entries, header)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, whiteout := range whiteouts {
+			removeFiles(files, whiteout)
+		}
+		for _, header := range entries {
+			name := packagePath(header.Name)
+			// Any entry replaces a file from a lower layer, and anything but a directory
+			// also replaces a directory, but only regular files and hardlinks to them are examined
+			if header.Typeflag == tar.TypeDir {
+				delete(files, name)
+			} else {
+				removeFiles(files, name)
+			}
+			switch header.Typeflag {
+			case tar.TypeReg:
+				files[name] = layerFile{i, name}
+			case tar.TypeLink:
+				// The target is in this layer or in a lower one
+				if target, ok := files[packagePath(header.Linkname)]; ok {
+					files[name] = target
+				}
+			}
+		}
+	}
+
+	// The paths in the root filesystem for each regular file entry, in order
+	paths := make(map[layerFile][]string)
+	for name, file := range files {
+		paths[file] = append(paths[file], name)
+	}
+	for _, names := range paths {
+		sort.Strings(names)
+	}
+
+	var (
+		results []result
+		err     error
+	)
+	for i, layer := range img.layers {
+		err = walkLayer(e, source, layer, func(header *tar.Header, tr *tar.Reader) error {
+			if header.Typeflag != tar.TypeReg {
+				return nil
+			}
+			names := paths[layerFile{i, packagePath(header.Name)}]
+			if len(names) == 0 {
+				return nil
+			}
+			// Hardlinks have the same contents, so the file is examined once
+			memberResults, err := examinePackageFile(e, names[0], tr, header.Size, depth+1)
+			for _, name := range names {
+				results = append(results, renameResults(memberResults, names[0], name)...)
+			}
+			return err
+		})
+		if err != nil {
+			break
+		}
+	}
+	for i := range results {
+		results[i].group = img.name
+	}
+	return results, err
+}
+
+// renameResults returns a copy of the results for the file with the given name,
+// as if they were for the file with the new name
+func renameResults(results []result, name, newName string) []result {
+	renamed := make([]result, len(results))
+	for i, res := range results {
+		if res.name == name {
+			res.name = newName
+		} else if strings.HasPrefix(res.name, name+"(") {
+			res.name = newName + strings.TrimPrefix(res.name, name)
+		}
+		renamed[i] = res
+	}
+	return renamed
+}
+
+// examineImages examines every image in the given docker save tarball or OCI image layout
+func examineImages(e *examination, source imageSource, depth int) ([]result, error) {
+	images, err := resolveImages(source)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return nil, errors.New("no images found")
+	}
+	var results []result
+	for _, img := range images {
+		imageResults, err := examineImage(e, source, img, depth)
+		results = append(results, imageResults...)
+		if stopped := e.stopped(); stopped != nil {
+			return results, stopped
+		}
+		if err != nil {
+			return nil, errors.New(img.name + ": " + err.Error())
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// testEntry is an entry in a tar archive for test fixtures
+type testEntry struct {
+	name     string
+	typeflag byte
+	contents string // or the target of a link
+}
+
+// testTar returns a tar archive with the given entries
+func testTar(t testing.TB, entries []testEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Typeflag: entry.typeflag, Mode: 0o755}
+		switch entry.typeflag {
+		case tar.TypeLink, tar.TypeSymlink:
+			header.Linkname = entry.contents
+		case tar.TypeReg:
+			header.Size = int64(len(entry.contents))
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.contents)); err != nil && entry.typeflag == tar.TypeReg {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// writeTestImage writes an OCI image layout with one image, that has the given layers, to dir
+func writeTestImage(t *testing.T, dir string, layers [][]byte) {
+	t.Helper()
+	writeBlob := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		digest := hex.EncodeToString(sum[:])
+		blobDir := filepath.Join(dir, "blobs", "sha256")
+		if err := os.MkdirAll(blobDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(blobDir, digest), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return "sha256:" + digest
+	}
+	writeJSON := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return writeBlob(data)
+	}
+	manifest := ociManifest{Config: ociDescriptor{Digest: writeJSON(ociConfig{OS: "linux", Architecture: "amd64"})}}
+	for _, layer := range layers {
+		manifest.Layers = append(manifest.Layers, ociDescriptor{Digest: writeBlob(layer)})
+	}
+	index := ociIndex{Manifests: []ociDescriptor{{
+		Digest:      writeJSON(manifest),
+		Annotations: map[string]string{ociRefNameAnnotation: "test"},
+	}}}
+	data, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExamineImage(t *testing.T) {
+	exe, text := string(testELF()), "not an executable"
+	for _, tc := range []struct {
+		name   string
+		layers [][]testEntry
+		want   []string
+	}{
+		{
+			name:   "one layer",
+			layers: [][]testEntry{{{"bin/", tar.TypeDir, ""}, {"bin/a", tar.TypeReg, exe}, {"bin/b", tar.TypeReg, text}}},
+			want:   []string{"/bin/a"},
+		},
+		{
+			name: "replaced",
+			layers: [][]testEntry{
+				{{"bin/a", tar.TypeReg, exe}, {"bin/b", tar.TypeReg, exe}},
+				{{"bin/a", tar.TypeReg, text}, {"bin/b", tar.TypeSymlink, "a"}},
+			},
+		},
+		{
+			name: "whiteouts",
+			layers: [][]testEntry{
+				{{"bin/a", tar.TypeReg, exe}, {"usr/bin/b", tar.TypeReg, exe}, {"usr/lib/c", tar.TypeReg, exe}},
+				{{"bin/.wh.a", tar.TypeReg, ""}, {"usr/.wh..wh..opq", tar.TypeReg, ""}, {"usr/lib/d", tar.TypeReg, exe}},
+			},
+			want: []string{"/usr/lib/d"},
+		},
+		{
+			name: "whiteout of everything",
+			layers: [][]testEntry{
+				{{"bin/a", tar.TypeReg, exe}},
+				{{"./.wh..wh..opq", tar.TypeReg, ""}, {"bin/b", tar.TypeReg, exe}},
+			},
+			want: []string{"/bin/b"},
+		},
+		{
+			name: "directory replaced by a file",
+			layers: [][]testEntry{
+				{{"lib/dir/", tar.TypeDir, ""}, {"lib/dir/a", tar.TypeReg, exe}, {"opt/dir/b", tar.TypeReg, exe}},
+				{{"lib/dir", tar.TypeSymlink, "/usr/lib"}, {"opt/dir/", tar.TypeDir, ""}},
+			},
+			want: []string{"/opt/dir/b"},
+		},
+		{
+			name: "hardlinks within a layer",
+			layers: [][]testEntry{
+				{{"bin/a", tar.TypeReg, exe}, {"bin/b", tar.TypeLink, "bin/a"}, {"bin/c", tar.TypeLink, "./bin/missing"}},
+			},
+			want: []string{"/bin/a", "/bin/b"},
+		},
+		{
+			name: "hardlinks across layers",
+			layers: [][]testEntry{
+				{{"bin/a", tar.TypeReg, exe}, {"bin/b", tar.TypeReg, text}},
+				{{"bin/c", tar.TypeLink, "bin/a"}, {"bin/d", tar.TypeLink, "bin/b"}},
+				{{"bin/.wh.a", tar.TypeReg, ""}},
+			},
+			want: []string{"/bin/c"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var layers [][]byte
+			for _, entries := range tc.layers {
+				layers = append(layers, testTar(t, entries))
+			}
+			dir := t.TempDir()
+			writeTestImage(t, dir, layers)
+			results, err := examineImages(&examination{ctx: context.Background()}, dirSource(dir), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := resultNames(results)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+			for _, res := range results {
+				if res.group != "test linux/amd64" {
+					t.Errorf("%s: got the image %q, want %q", res.name, res.group, "test linux/amd64")
+				}
+			}
+		})
+	}
+}
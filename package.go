@@ -0,0 +1,293 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	debianBinary = "debian-binary"
+	rpmLeadSize  = 96
+	cpioNewc     = "070701"
+	cpioNewcCRC  = "070702"
+	cpioTrailer  = "TRAILER!!!"
+
+	// interestingSize is how much of a file in a package is read for checking if it is interesting
+	interestingSize = 512
+)
+
+var (
+	elfMagic       = []byte("\x7fELF")
+	rpmMagic       = []byte{0xed, 0xab, 0xee, 0xdb}
+	rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+)
+
+// isDeb checks if the given data is a Debian package, which is an ar archive
+// where the first member is named "debian-binary"
+func isDeb(r io.ReaderAt) bool {
+	header := make([]byte, len(arMagic)+len(debianBinary))
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return false
+	}
+	return string(header) == arMagic+debianBinary
+}
+
+// isRPM checks if the given data starts with the magic bytes of an RPM package
+func isRPM(r io.ReaderAt) bool {
+	magic := make([]byte, len(rpmMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, rpmMagic)
+}
+
+// isTar checks if the given data starts with a POSIX or GNU tar header.
+// Arch Linux packages and Alpine Linux packages are compressed tar archives.
+func isTar(r io.ReaderAt) bool {
+	magic := make([]byte, 5)
+	if _, err := r.ReadAt(magic, 257); err != nil {
+		return false
+	}
+	return string(magic) == "ustar"
+}
+
+// packagePath returns the given path within a package as an absolute path,
+// for example "./usr/bin/ls" becomes "/usr/bin/ls"
+func packagePath(name string) string {
+	return path.Clean("/" + strings.TrimPrefix(name, "./"))
+}
+
+// interesting checks if the given header, which is the first 512 bytes of a file
+// or less, belongs to a file that should be examined when scanning a package:
+// ELF files, static libraries, ZIP archives, SquashFS images, tar archives
+// and compressed files.
+func interesting(header []byte) bool {
+	for _, magic := range []string{string(elfMagic), arMagic, zipMagic, squashfsMagic} {
+		if bytes.HasPrefix(header, []byte(magic)) {
+			return true
+		}
+	}
+	return isTar(bytes.NewReader(header)) || detectCompression(header) != nil
+}
+
+// examinePackageFile examines a regular file with the given path and size,
+// that can be read from r, within a package or an archive. Files that are not
+// ELF files, archives or compressed are skipped without reading all of the data.
+// depth is how deeply nested within other archives the file is. An error is only
+// returned when the examination stops, with the results that were found until then.
+func examinePackageFile(e *examination, name string, r io.Reader, size int64, depth int) ([]result, error) {
+	if err := e.stopped(); err != nil {
+		return nil, err
+	}
+	header := make([]byte, interestingSize)
+	n, _ := io.ReadFull(r, header)
+	header = header[:n]
+	if !interesting(header) {
+		return nil, nil
+	}
+	if size > e.memoryLeft() {
+		return []result{{name: name, err: e.tooLarge()}}, nil
+	}
+	data := io.MultiReader(bytes.NewReader(header), r)
+	var (
+		contents []byte
+		err      error
+	)
+	if c := detectCompression(header); c != nil {
+		contents, err = decompressAll(e, c, data)
+	} else {
+		contents, err = e.readAll(data)
+	}
+	defer e.release(contents)
+	if stopped := e.stopped(); stopped != nil {
+		return nil, stopped
+	}
+	if err != nil {
+		return []result{{name: name, err: err}}, nil
+	}
+	// The compressed data may be shorter than the header that is checked
+	if !interesting(contents[:min(len(contents), interestingSize)]) {
+		return nil, nil
+	}
+	// ELF files can be examined at any depth, but the members of archives would be nested deeper
+	if depth > maxDepth && !bytes.HasPrefix(contents, elfMagic) {
+		return []result{{name: name, err: errors.New("archives are nested too deeply")}}, nil
+	}
+	memberResults, err := examineData(e, bytes.NewReader(contents), int64(len(contents)), "", depth)
+	stopped := e.stopped()
+	if err != nil && stopped == nil {
+		return []result{{name: name, err: err}}, nil
+	}
+	for i := range memberResults {
+		if memberResults[i].name == "" {
+			memberResults[i].name = name
+		} else {
+			memberResults[i].name = name + "(" + memberResults[i].name + ")"
+		}
+	}
+	return memberResults, stopped
+}
+
+// examineTar examines every regular file in the tar archive that can be read from r
+func examineTar(e *examination, r io.Reader, depth int) ([]result, error) {
+	var results []result
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return results, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		memberResults, err := examinePackageFile(e, packagePath(header.Name), tr, header.Size, depth+1)
+		results = append(results, memberResults...)
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// examineDeb examines the ELF files in the data.tar member of a Debian package
+func examineDeb(e *examination, r io.ReaderAt, size int64, depth int) ([]result, error) {
+	members, err := readArchive(r, size, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		if !strings.HasPrefix(member.name, "data.tar") {
+			continue
+		}
+		data, err := decompressStream(e, io.NewSectionReader(member.r, 0, member.size))
+		if err != nil {
+			return nil, errors.New(member.name + ": " + err.Error())
+		}
+		defer data.Close()
+		return examineTar(e, data, depth)
+	}
+	return nil, errors.New("no data.tar member in the Debian package")
+}
+
+// rpmHeaderSize returns the size of the RPM header structure at the given offset
+func rpmHeaderSize(r io.ReaderAt, offset int64) (int64, error) {
+	header := make([]byte, 16)
+	if _, err := r.ReadAt(header, offset); err != nil {
+		return 0, errors.New("truncated RPM header")
+	}
+	if !bytes.Equal(header[:4], rpmHeaderMagic) {
+		return 0, errors.New("invalid RPM header")
+	}
+	indexCount := int64(binary.BigEndian.Uint32(header[8:]))
+	dataSize := int64(binary.BigEndian.Uint32(header[12:]))
+	return 16 + indexCount*16 + dataSize, nil
+}
+
+// examineRPM examines the ELF files in the cpio payload of an RPM package
+func examineRPM(e *examination, r io.ReaderAt, size int64, depth int) ([]result, error) {
+	// The lead is followed by the signature header, which is padded to 8 bytes,
+	// and then by the main header and the compressed payload.
+	signatureSize, err := rpmHeaderSize(r, rpmLeadSize)
+	if err != nil {
+		return nil, err
+	}
+	offset := rpmLeadSize + signatureSize
+	if offset%8 != 0 {
+		offset += 8 - offset%8
+	}
+	headerSize, err := rpmHeaderSize(r, offset)
+	if err != nil {
+		return nil, err
+	}
+	offset += headerSize
+	if offset > size {
+		return nil, errors.New("truncated RPM package")
+	}
+	payload, err := decompressStream(e, io.NewSectionReader(r, offset, size-offset))
+	if err != nil {
+		return nil, errors.New("RPM payload: " + err.Error())
+	}
+	defer payload.Close()
+	return examineCpio(e, payload, depth)
+}
+
+// examineCpio examines every regular file in the cpio archive (newc format) that can be read from r
+func examineCpio(e *examination, r io.Reader, depth int) ([]result, error) {
+	var (
+		results []result
+		header  = make([]byte, 110)
+		offset  int64
+	)
+	// skip reads and discards n bytes
+	skip := func(n int64) error {
+		m, err := io.CopyN(io.Discard, r, n)
+		offset += m
+		return err
+	}
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return results, errors.New("truncated cpio archive")
+		}
+		offset += int64(len(header))
+		if magic := string(header[:6]); magic != cpioNewc && magic != cpioNewcCRC {
+			return results, errors.New("unsupported cpio format")
+		}
+		// field returns the given hexadecimal header field, numbered from 0 (the inode)
+		field := func(i int) (int64, error) {
+			return strconv.ParseInt(string(header[6+i*8:6+(i+1)*8]), 16, 64)
+		}
+		mode, err := field(1)
+		if err != nil {
+			return results, errors.New("corrupt cpio header")
+		}
+		fileSize, err := field(6)
+		if err != nil {
+			return results, errors.New("corrupt cpio header")
+		}
+		nameSize, err := field(11)
+		if err != nil || nameSize <= 0 || nameSize > 4096 {
+			return results, errors.New("corrupt cpio header")
+		}
+		nameBytes := make([]byte, nameSize)
+		if _, err := io.ReadFull(r, nameBytes); err != nil {
+			return results, errors.New("truncated cpio archive")
+		}
+		offset += nameSize
+		name := string(bytes.TrimRight(nameBytes, "\x00"))
+		if name == cpioTrailer {
+			return results, nil
+		}
+		// The header and the name are padded to 4 bytes
+		if err := skip((4 - offset%4) % 4); err != nil {
+			return results, errors.New("truncated cpio archive")
+		}
+		data := &io.LimitedReader{R: r, N: fileSize}
+		if mode&0170000 == 0100000 && fileSize > 0 {
+			memberResults, err := examinePackageFile(e, packagePath(name), data, fileSize, depth+1)
+			results = append(results, memberResults...)
+			if err != nil {
+				return results, err
+			}
+		}
+		// Skip the rest of the file data, which is also padded to 4 bytes
+		if _, err := io.Copy(io.Discard, data); err != nil {
+			return results, err
+		}
+		if data.N > 0 {
+			return results, errors.New("truncated cpio archive")
+		}
+		offset += fileSize
+		if err := skip((4 - offset%4) % 4); err != nil {
+			return results, errors.New("truncated cpio archive")
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// testGzip returns the given data, compressed with gzip
+func testGzip(t testing.TB, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testCpio returns a cpio archive in the newc format, with the given entries and a trailer
+func testCpio(entries []testEntry) []byte {
+	var buf bytes.Buffer
+	pad := func() {
+		for buf.Len()%4 != 0 {
+			buf.WriteByte(0)
+		}
+	}
+	write := func(name string, mode int, data string) {
+		fmt.Fprintf(&buf, "%s%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x", cpioNewc, 1, mode, 0, 0, 1, 0, len(data), 0, 0, 0, 0, len(name)+1, 0)
+		buf.WriteString(name + "\x00")
+		pad()
+		buf.WriteString(data)
+		pad()
+	}
+	for _, entry := range entries {
+		switch entry.typeflag {
+		case tar.TypeDir:
+			write(entry.name, 0o040755, "")
+		case tar.TypeSymlink:
+			write(entry.name, 0o120777, entry.contents)
+		default:
+			write(entry.name, 0o100755, entry.contents)
+		}
+	}
+	write(cpioTrailer, 0, "")
+	return buf.Bytes()
+}
+
+// testRPMHeader returns an RPM header structure with the given number of index entries and data size
+func testRPMHeader(indexCount, dataSize int) []byte {
+	header := make([]byte, 16+indexCount*16+dataSize)
+	copy(header, rpmHeaderMagic)
+	binary.BigEndian.PutUint32(header[8:], uint32(indexCount))
+	binary.BigEndian.PutUint32(header[12:], uint32(dataSize))
+	return header
+}
+
+// testRPM returns an RPM package with the given payload. The signature header is padded to 8 bytes.
+func testRPM(payload []byte) []byte {
+	lead := make([]byte, rpmLeadSize)
+	copy(lead, rpmMagic)
+	signature := testRPMHeader(0, 5)
+	rpm := append(lead, signature...)
+	rpm = append(rpm, make([]byte, 8-len(rpm)%8)...)
+	rpm = append(rpm, testRPMHeader(1, 3)...)
+	return append(rpm, payload...)
+}
+
+func TestExaminePackages(t *testing.T) {
+	exe, text := string(testELF()), "not an executable"
+	files := []testEntry{
+		{"./usr/", tar.TypeDir, ""},
+		{"./usr/bin/a", tar.TypeReg, exe},
+		{"./usr/bin/b", tar.TypeSymlink, "a"},
+		{"./usr/share/doc/README", tar.TypeReg, text},
+		{"usr/lib/libc.so", tar.TypeReg, exe},
+	}
+	nested := testTar(t, []testEntry{{"lib/x.a", tar.TypeReg, string(testAr(arMagic, "x.o/", exe))}})
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want []string
+		err  string
+	}{
+		{
+			name: "tar",
+			data: testTar(t, files),
+			want: []string{"/usr/bin/a", "/usr/lib/libc.so"},
+		},
+		{
+			name: "Arch Linux package",
+			data: testGzip(t, testTar(t, append([]testEntry{{".PKGINFO", tar.TypeReg, "pkgname = a\n"}}, files...))),
+			want: []string{"/usr/bin/a", "/usr/lib/libc.so"},
+		},
+		{
+			name: "nested archives",
+			data: testTar(t, []testEntry{{"a.tar.gz", tar.TypeReg, string(testGzip(t, nested))}}),
+			want: []string{"/a.tar.gz(/lib/x.a(x.o))"},
+		},
+		{
+			name: "Debian package",
+			data: testAr(arMagic, debianBinary, "2.0\n", "control.tar.gz", string(testGzip(t, testTar(t, nil))), "data.tar.gz", string(testGzip(t, testTar(t, files)))),
+			want: []string{"/usr/bin/a", "/usr/lib/libc.so"},
+		},
+		{
+			name: "Debian package with an uncompressed data.tar",
+			data: testAr(arMagic, debianBinary, "2.0\n", "data.tar", string(testTar(t, files))),
+			want: []string{"/usr/bin/a", "/usr/lib/libc.so"},
+		},
+		{
+			name: "Debian package without data.tar",
+			data: testAr(arMagic, debianBinary, "2.0\n", "control.tar.gz", string(testGzip(t, testTar(t, nil)))),
+			err:  "no data.tar member in the Debian package",
+		},
+		{
+			name: "RPM package",
+			data: testRPM(testGzip(t, testCpio(files))),
+			want: []string{"/usr/bin/a", "/usr/lib/libc.so"},
+		},
+		{
+			name: "RPM package with an invalid header",
+			data: append(testRPM(nil)[:rpmLeadSize], 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0),
+			err:  "invalid RPM header",
+		},
+		{
+			name: "truncated RPM package",
+			data: append(testRPM(nil), testRPMHeader(0, 64)[:16]...)[:rpmLeadSize+24+16],
+			err:  "truncated RPM package",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := examineBytes(&examination{ctx: context.Background()}, tc.data)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("got the error %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resultNames(results); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExamineCpio(t *testing.T) {
+	exe := string(testELF())
+	archive := testCpio([]testEntry{{"bin", tar.TypeDir, ""}, {"bin/a", tar.TypeReg, exe}, {"bin/b", tar.TypeSymlink, "a"}, {"bin/c", tar.TypeReg, "c"}})
+	crc := bytes.ReplaceAll(archive, []byte(cpioNewc), []byte(cpioNewcCRC))
+	for _, tc := range []struct {
+		name    string
+		archive []byte
+		want    []string
+		err     string
+	}{
+		{"newc", archive, []string{"/bin/a"}, ""},
+		{"newc with checksums", crc, []string{"/bin/a"}, ""},
+		{"empty", testCpio(nil), nil, ""},
+		{"no trailer", archive[:bytes.Index(archive, []byte(cpioTrailer))-110], []string{"/bin/a"}, "truncated cpio archive"},
+		{"truncated", archive[:200], nil, "truncated cpio archive"},
+		{"truncated data", archive[:len(archive)-150], []string{"/bin/a"}, "truncated cpio archive"},
+		{"odc format", append([]byte("070707"), archive[6:]...), nil, "unsupported cpio format"},
+		{"corrupt header", append([]byte(cpioNewc+"00000001"+"0000000x"), archive[22:]...), nil, "corrupt cpio header"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := examineCpio(&examination{ctx: context.Background()}, bytes.NewReader(tc.archive), 0)
+			if tc.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tc.err != "" && (err == nil || err.Error() != tc.err) {
+				t.Fatalf("got the error %v, want %q", err, tc.err)
+			}
+			if got := resultNames(results); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRPMHeaderSize(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		header []byte
+		want   int64
+		err    string
+	}{
+		{"empty", testRPMHeader(0, 0), 16, ""},
+		{"entries", testRPMHeader(3, 100), 16 + 3*16 + 100, ""},
+		{"largest", append(rpmHeaderMagic, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff), 16 + 0xffffffff*16 + 0xffffffff, ""},
+		{"invalid magic", make([]byte, 16), 0, "invalid RPM header"},
+		{"truncated", rpmHeaderMagic, 0, "truncated RPM header"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := rpmHeaderSize(bytes.NewReader(tc.header), 0)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("got the error %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("got %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestExamineTarErrors checks that the members that were examined before an error are returned
+func TestExamineTarErrors(t *testing.T) {
+	archive := testTar(t, []testEntry{{"a", tar.TypeReg, string(testELF())}, {"b", tar.TypeReg, string(testELF())}})
+	results, err := examineTar(&examination{ctx: context.Background()}, bytes.NewReader(archive[:1024+100]), 0)
+	if err == nil {
+		t.Fatal("expected an error for a truncated tar archive")
+	}
+	if got, want := resultNames(results), []string{"/a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := examineTar(&examination{ctx: ctx}, bytes.NewReader(archive), 0); err == nil {
+		t.Error("expected an error when the examination has stopped")
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// policyRule is a single rule in a policy file, like "GCC >= 12", "no TCC" or "must be PIE"
+type policyRule struct {
+	text     string // the rule, as written in the policy file
+	forbid   bool   // for "no COMPILER", where the compiler, or the given versions of it, are not allowed
+	pie      bool   // for "must be PIE", where all executables must be position independent
+	compiler string
+	versions []versionConstraint
+}
+
+// parsePolicyRule parses a rule like "GCC >= 12", "Go >=1.21,<1.23", "no TCC",
+// "no GCC < 8", "no unknown" or "must be PIE"
+func parsePolicyRule(text string) (policyRule, error) {
+	rule := policyRule{text: text}
+	fields := strings.Fields(text)
+	if strings.EqualFold(strings.Join(fields, " "), "must be PIE") {
+		rule.pie = true
+		return rule, nil
+	}
+	if len(fields) > 0 && strings.EqualFold(fields[0], "no") {
+		rule.forbid = true
+		fields = fields[1:]
+	}
+	// The compiler name is everything up to the first version constraint
+	i := 0
+	for i < len(fields) && strings.IndexAny(fields[i][:1], "<>=!0123456789") == -1 {
+		i++
+	}
+	if i == 0 {
+		return rule, errors.New("expected a compiler name: " + text)
+	}
+	rule.compiler = strings.Join(fields[:i], " ")
+	if i == len(fields) {
+		if !rule.forbid {
+			return rule, errors.New("expected version constraints after " + rule.compiler + ": " + text)
+		}
+		return rule, nil
+	}
+	var err error
+	if rule.versions, err = parseConstraints(strings.Join(fields[i:], " ")); err != nil {
+		return rule, errors.New(err.Error() + ": " + text)
+	}
+	return rule, nil
+}
+
+// parsePolicy parses a policy file, which is a YAML file with a list of rules:
+//
+//	rules:
+//	  - GCC >= 12
+//	  - Go >= 1.21
+//	  - no TCC
+//	  - no unknown
+//	  - must be PIE
+//
+// Only this subset of YAML is supported. source is used in error messages.
+func parsePolicy(r io.Reader, source string) ([]policyRule, error) {
+	var rules []policyRule
+	inRules := false
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+		where := source + ":" + strconv.Itoa(lineNumber)
+		if line == "rules:" {
+			inRules = true
+			continue
+		}
+		item, ok := strings.CutPrefix(line, "- ")
+		if !ok || !inRules {
+			return nil, errors.New(where + ": expected a list of rules, like \"rules:\" followed by \"- GCC >= 12\"")
+		}
+		if pos := strings.Index(item, " #"); pos != -1 {
+			item = item[:pos]
+		}
+		item = strings.TrimSpace(item)
+		if unquoted, err := strconv.Unquote(item); err == nil {
+			item = unquoted
+		} else if len(item) >= 2 && item[0] == '\'' && item[len(item)-1] == '\'' {
+			item = item[1 : len(item)-1]
+		}
+		rule, err := parsePolicyRule(item)
+		if err != nil {
+			return nil, errors.New(where + ": " + err.Error())
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, errors.New(source + ": no rules found")
+	}
+	return rules, nil
+}
+
+// loadPolicy reads the rules from the given policy file
+func loadPolicy(filename string) ([]policyRule, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parsePolicy(f, filename)
+}
+
+// violates checks if the given result violates the rule, and returns a message if it does
+func (rule *policyRule) violates(res *result) (string, bool) {
+	if rule.pie {
+		if res.details == nil || !res.details.executable || res.details.pie {
+			return "", false
+		}
+		return "not a position independent executable (" + rule.text + ")", true
+	}
+	t := parseTool(res.compiler)
+	if !strings.EqualFold(t.name, rule.compiler) {
+		return "", false
+	}
+	switch {
+	case rule.forbid && len(rule.versions) == 0:
+		return res.compiler + " is not allowed (" + rule.text + ")", true
+	case rule.forbid && t.version != "" && matchesAll(rule.versions, t.version):
+		return res.compiler + " is not allowed (" + rule.text + ")", true
+	case rule.forbid:
+		return "", false
+	case t.version == "":
+		return "the version of " + res.compiler + " is unknown (" + rule.text + ")", true
+	case !matchesAll(rule.versions, t.version):
+		return res.compiler + " is not allowed (" + rule.text + ")", true
+	}
+	return "", false
+}
+
+// checkPolicy adds findings to the given results, for every policy rule that is violated,
+// and returns the number of findings
+func checkPolicy(results []result, rules []policyRule) int {
+	count := 0
+	for i := range results {
+		res := &results[i]
+		if res.err != nil {
+			continue
+		}
+		for j := range rules {
+			if message, ok := rules[j].violates(res); ok {
+				res.findings = append(res.findings, finding{
+					rule:    "policy",
+					id:      rules[j].text,
+					level:   levelError,
+					message: message,
+				})
+				count++
+			}
+		}
+	}
+	return count
+}
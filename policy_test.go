@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		text  string
+		rules []string
+		err   string
+	}{
+		{
+			name:  "rules",
+			text:  "---\n# the policy\nrules:\n  - GCC >= 12\n  - \"Go >=1.21,<1.23\"  \n  - 'no TCC'\n  - no GCC < 8 # too old\n  - no unknown\n  - must be PIE\n  - Free Pascal >= 3.2\n",
+			rules: []string{"GCC >= 12", "Go >=1.21,<1.23", "no TCC", "no GCC < 8", "no unknown", "must be PIE", "Free Pascal >= 3.2"},
+		},
+		{name: "no rules", text: "rules:\n", err: "test: no rules found"},
+		{name: "no list", text: "- GCC >= 12\n", err: `test:1: expected a list of rules, like "rules:" followed by "- GCC >= 12"`},
+		{name: "not a list", text: "rules:\n  GCC >= 12\n", err: `test:2: expected a list of rules, like "rules:" followed by "- GCC >= 12"`},
+		{name: "no compiler", text: "rules:\n  - >= 12\n", err: "test:2: expected a compiler name: >= 12"},
+		{name: "no versions", text: "rules:\n  - GCC\n", err: "test:2: expected version constraints after GCC: GCC"},
+		{name: "invalid version", text: "rules:\n  - GCC >= x\n", err: "test:2: invalid version: x: GCC >= x"},
+		{name: "invalid constraint", text: "rules:\n  - GCC >= 12,<y\n", err: "test:2: invalid version: y: GCC >= 12,<y"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := parsePolicy(strings.NewReader(tc.text), "test")
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("got the error %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, rule := range rules {
+				got = append(got, rule.text)
+			}
+			if !reflect.DeepEqual(got, tc.rules) {
+				t.Errorf("got %q, want %q", got, tc.rules)
+			}
+		})
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	rules, err := parsePolicy(strings.NewReader("rules:\n- GCC >= 12\n- no TCC\n- no Clang < 15\n- no unknown\n- must be PIE\n"), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		res  result
+		want []string
+	}{
+		{result{compiler: "GCC 13.2.1"}, nil},
+		{result{compiler: "GCC 11.4.0"}, []string{"GCC 11.4.0 is not allowed (GCC >= 12)"}},
+		{result{compiler: "GCC"}, []string{"the version of GCC is unknown (GCC >= 12)"}},
+		{result{compiler: "TCC 0.9.27"}, []string{"TCC 0.9.27 is not allowed (no TCC)"}},
+		{result{compiler: "Clang 14.0.6"}, []string{"Clang 14.0.6 is not allowed (no Clang < 15)"}},
+		{result{compiler: "Clang 17.0.6"}, nil},
+		{result{compiler: "Clang"}, nil},
+		{result{compiler: "unknown"}, []string{"unknown is not allowed (no unknown)"}},
+		{result{compiler: "Go 1.22.1", details: &details{executable: true}}, []string{"not a position independent executable (must be PIE)"}},
+		{result{compiler: "Go 1.22.1", details: &details{executable: true, pie: true}}, nil},
+		{result{compiler: "GCC 11.4.0", err: errTooLarge}, nil},
+	} {
+		results := []result{tc.res}
+		n := checkPolicy(results, rules)
+		var got []string
+		for _, fi := range results[0].findings {
+			got = append(got, fi.message)
+		}
+		if n != len(got) || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %d findings, %q, want %q", tc.res.compiler, n, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// mapping is a file that is mapped into the memory of a running process, as listed in /proc/N/maps
+type mapping struct {
+	addresses string // the address range, like "7f1c2a000000-7f1c2a022000"
+	key       string // the device and inode, for recognizing the same file across processes
+	name      string
+}
+
+// processResult holds the results of examining one running process
+type processResult struct {
+	pid     int
+	results []result
+	err     error
+}
+
+// processCache holds the results for files that have already been examined,
+// since most processes map the same shared libraries
+type processCache map[string]result
+
+// processMappings returns the files that are mapped into the memory of the given process,
+// in the order of the first mapping of each file
+func processMappings(pid int) ([]mapping, error) {
+	f, err := os.Open(filepath.Join("/proc", strconv.Itoa(pid), "maps"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var (
+		mappings []mapping
+		seen     = make(map[string]bool)
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// The fields are: address, permissions, offset, device, inode and pathname
+		fields := strings.SplitN(scanner.Text(), " ", 6)
+		if len(fields) < 6 {
+			continue
+		}
+		name := strings.TrimSpace(fields[5])
+		if !strings.HasPrefix(name, "/") || fields[4] == "0" {
+			// Anonymous memory, the heap, the stack and the vdso
+			continue
+		}
+		key := fields[3] + " " + fields[4]
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		mappings = append(mappings, mapping{addresses: fields[0], key: key, name: name})
+	}
+	return mappings, scanner.Err()
+}
+
+// processName returns the command name of the given process
+func processName(pid int) string {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "comm"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// examineMapping examines a file that is mapped into the memory of the given process.
+// If the file has been deleted on disk, the file that is actually mapped is read
+// through /proc/N/map_files, if permitted.
+func examineMapping(e *examination, pid int, m mapping) result {
+	if strings.HasSuffix(m.name, deletedSuffix) {
+		return examineNamedFile(e, m.name, filepath.Join("/proc", strconv.Itoa(pid), "map_files", m.addresses))
+	}
+	return examineNamedFile(e, m.name, m.name)
+}
+
+// examineProcess examines the executable of the given process, even if it has been deleted
+// or replaced on disk since the process was started, and every shared object that is mapped
+// into its memory. The results are grouped by the command name of the process. When the
+// examination stops, the results so far are returned, with detect.ErrTimedOut or detect.ErrCancelled.
+func examineProcess(e *examination, pid int, cache processCache) ([]result, error) {
+	procDir := filepath.Join("/proc", strconv.Itoa(pid))
+	exeLink := filepath.Join(procDir, "exe")
+	exeName, err := os.Readlink(exeLink)
+	if err != nil {
+		return nil, err
+	}
+	group := processName(pid)
+	// Examine the executable through /proc/N/exe, which is the file that is actually running
+	exe := examineNamedFile(e, exeName, exeLink)
+	exe.group = group
+	results := []result{exe}
+	mappings, err := processMappings(pid)
+	if err != nil {
+		results = append(results, result{name: filepath.Join(procDir, "maps"), group: group, err: err})
+		return results, nil
+	}
+	for _, m := range mappings {
+		if err := e.stopped(); err != nil {
+			return results, err
+		}
+		if m.name == exeName {
+			continue
+		}
+		res, ok := cache[m.key]
+		if !ok {
+			res = examineMapping(e, pid, m)
+			if res.err == nil {
+				cache[m.key] = res
+			}
+		}
+		res.group = group
+		results = append(results, res)
+	}
+	return results, e.stopped()
+}
+
+// processIDs returns the IDs of all running processes, in ascending order
+func processIDs() ([]int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, entry := range entries {
+		if pid, err := strconv.Atoi(entry.Name()); err == nil && entry.IsDir() {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+	return pids, nil
+}
+
+// examineAllProcesses examines all running processes, with a new examination for each one,
+// from newExamination. Kernel threads, which have no executable, and processes that exit while
+// they are being examined are skipped. Processes that can not be inspected, because of missing
+// permissions, or that took too long to examine, have an error.
+func examineAllProcesses(newExamination func() (*examination, context.CancelFunc)) ([]processResult, error) {
+	pids, err := processIDs()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		processes []processResult
+		cache     = make(processCache)
+	)
+	for _, pid := range pids {
+		e, cancel := newExamination()
+		results, err := examineProcess(e, pid, cache)
+		cancel()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		processes = append(processes, processResult{pid: pid, results: results, err: err})
+	}
+	return processes, nil
+}
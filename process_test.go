@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestProcessMappings(t *testing.T) {
+	if _, err := os.Stat("/proc/self/maps"); err != nil {
+		t.Skip("/proc is not available")
+	}
+	exe, err := os.Readlink("/proc/self/exe")
+	if err != nil {
+		t.Skip(err)
+	}
+	mappings, err := processMappings(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	found := false
+	for _, m := range mappings {
+		if seen[m.key] {
+			t.Errorf("%s is listed more than once", m.name)
+		}
+		seen[m.key] = true
+		found = found || m.name == exe
+	}
+	if !found {
+		t.Errorf("%s is not among the mapped files", exe)
+	}
+	if processName(os.Getpid()) == "" {
+		t.Error("expected a command name")
+	}
+	if _, err := processMappings(-1); err == nil {
+		t.Error("expected an error for a process that does not exist")
+	}
+}
+
+func TestExamineProcess(t *testing.T) {
+	if _, err := os.Stat("/proc/self/exe"); err != nil {
+		t.Skip("/proc is not available")
+	}
+	e := &examination{ctx: context.Background(), root: rootFS{}}
+	cache := make(processCache)
+	results, err := examineProcess(e, os.Getpid(), cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 || results[0].err != nil {
+		t.Fatalf("expected the executable to be examined, got %+v", results)
+	}
+	group := processName(os.Getpid())
+	for _, res := range results {
+		if res.group != group {
+			t.Errorf("%s: expected the group %q, got %q", res.name, group, res.group)
+		}
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	e = &examination{ctx: cancelled, root: rootFS{}}
+	if _, err := examineProcess(e, os.Getpid(), cache); err == nil {
+		t.Error("expected an error when the examination is cancelled")
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"debug/buildinfo"
+	"debug/elf"
+	"encoding/hex"
+	"io"
+	"strings"
+
+	"github.com/xyproto/cdetect/detect"
+)
+
+// tool is a compiler, a linker or a language runtime, with a version if it is known
+type tool struct {
+	name    string
+	version string
+}
+
+// details is what is known about how an ELF file was built, in addition to the compiler
+type details struct {
+	size       int64
+	sha1       string
+	sha256     string
+	linker     *tool
+	runtimes   []tool
+	goBuild    *buildinfo.BuildInfo // for Go executables
+	crates     []crate              // for Rust executables built with "cargo auditable"
+	executable bool                 // an executable, and not a shared library or an object file
+	pie        bool                 // a position independent executable
+	relro      bool                 // has a read-only segment for relocations (PT_GNU_RELRO)
+	execStack  bool                 // requests an executable stack (PT_GNU_STACK with PF_X)
+	machine    string               // the architecture, like "x86_64" or "aarch64"
+	static     bool                 // statically linked
+}
+
+// parseTool splits a compiler or linker description like "GCC 13.2.1" or
+// "Rust 1.75.0 (GCC 13.2.1)" into a name and a version
+func parseTool(s string) tool {
+	d := detect.ParseDetection(s)
+	return tool{name: d.Name, version: d.Version}
+}
+
+// hashes returns the SHA-1 and SHA-256 checksums of the data that can be read from r
+func hashes(r io.ReaderAt, size int64) (string, string, error) {
+	h1, h256 := sha1.New(), sha256.New()
+	if _, err := io.Copy(io.MultiWriter(h1, h256), io.NewSectionReader(r, 0, size)); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(h1.Sum(nil)), hex.EncodeToString(h256.Sum(nil)), nil
+}
+
+// findLinker returns the linker that was used for linking the given ELF file, if it left
+// a trace. LLD and mold add a string to the .comment section, and gold adds a note.
+// r is what the ELF file is read from.
+func findLinker(r io.ReaderAt, f *elf.File) *tool {
+	if sec := f.Section(".note.gnu.gold-version"); sec != nil {
+		if data, err := detect.ReadSection(r, f, sec); err == nil {
+			if pos := bytes.Index(data, []byte("gold ")); pos != -1 {
+				gold := parseTool(string(bytes.TrimRight(data[pos:], "\x00")))
+				return &gold
+			}
+		}
+	}
+	sec := f.Section(".comment")
+	if sec == nil {
+		return nil
+	}
+	data, err := detect.ReadSection(r, f, sec)
+	if err != nil {
+		return nil
+	}
+	for _, comment := range strings.Split(string(data), "\x00") {
+		switch {
+		case strings.HasPrefix(comment, "Linker: "):
+			linker := parseTool(strings.TrimPrefix(comment, "Linker: "))
+			return &linker
+		case strings.HasPrefix(comment, "mold "):
+			linker := parseTool(comment)
+			return &linker
+		}
+	}
+	return nil
+}
+
+// findRuntimes returns the language runtimes that the given ELF file depends on. For the
+// C and C++ runtimes, the version is the highest symbol version that is required.
+func findRuntimes(f *elf.File, compiler string, goBuild *buildinfo.BuildInfo) []tool {
+	var runtimes []tool
+	if goBuild != nil {
+		runtimes = append(runtimes, tool{name: "Go runtime", version: strings.TrimPrefix(goBuild.GoVersion, "go")})
+	}
+	if detect.HasRustVersion(compiler) {
+		runtimes = append(runtimes, tool{name: "Rust standard library", version: parseTool(compiler).version})
+	}
+	if libs, err := f.ImportedLibraries(); err == nil {
+		for _, lib := range libs {
+			if strings.HasPrefix(lib, "libc.musl-") || strings.HasPrefix(lib, "ld-musl-") {
+				runtimes = append(runtimes, tool{name: "musl"})
+				break
+			}
+		}
+	}
+	needs, err := f.DynamicVersionNeeds()
+	if err != nil {
+		return runtimes
+	}
+	for _, runtime := range []struct{ name, library, prefix string }{
+		{"glibc", "libc.so", "GLIBC_"},
+		{"libstdc++", "libstdc++.so", "GLIBCXX_"},
+	} {
+		highest := ""
+		for _, need := range needs {
+			if !strings.HasPrefix(need.Name, runtime.library) {
+				continue
+			}
+			for _, dep := range need.Needs {
+				version, ok := strings.CutPrefix(dep.Dep, runtime.prefix)
+				if ok && (highest == "" || compareVersions(version, highest) > 0) {
+					highest = version
+				}
+			}
+		}
+		if highest != "" {
+			runtimes = append(runtimes, tool{name: runtime.name, version: highest})
+		}
+	}
+	return runtimes
+}
+
+// examineDetails finds the checksums of the data that can be read from r, if the examination
+// needs them, and, if it is an ELF file, the linker, the language runtimes, and the Go modules
+// or the Rust crates that it was built from. compiler is the compiler that has already been found.
+func examineDetails(e *examination, r io.ReaderAt, size int64, compiler string) (*details, error) {
+	d := &details{size: size}
+	if e.checksums {
+		var err error
+		if d.sha1, d.sha256, err = hashes(r, size); err != nil {
+			return nil, err
+		}
+	}
+	f, err := elf.NewFile(r)
+	if err != nil {
+		// Not an ELF file, like a bzImage
+		return d, nil
+	}
+	if goBuild, err := buildinfo.Read(r); err == nil {
+		d.goBuild = goBuild
+		d.linker = &tool{name: "Go linker", version: strings.TrimPrefix(goBuild.GoVersion, "go")}
+		for _, setting := range goBuild.Settings {
+			if setting.Key == "-ldflags" && strings.Contains(setting.Value, "-linkmode=external") {
+				d.linker = nil
+			}
+		}
+	}
+	if linker := findLinker(r, f); linker != nil {
+		d.linker = linker
+	}
+	d.runtimes = findRuntimes(f, compiler, d.goBuild)
+	d.executable, d.pie = elfExecutable(f)
+	d.machine = strings.ToLower(strings.TrimPrefix(f.Machine.String(), "EM_"))
+	d.static = detect.Static(f)
+	for _, prog := range f.Progs {
+		switch prog.Type {
+		case elf.PT_GNU_RELRO:
+			d.relro = true
+		case elf.PT_GNU_STACK:
+			d.execStack = prog.Flags&elf.PF_X != 0
+		}
+	}
+	// A corrupt dependency list is not fatal, since the compiler has already been found
+	d.crates, _ = readAuditable(r, f)
+	return d, nil
+}
+
+// elfExecutable checks if the given ELF file is an executable, and if it is a position
+// independent executable. Both PIEs and shared libraries are of the type ET_DYN, but
+// PIEs have a program interpreter, or the DF_1_PIE flag if they are statically linked.
+func elfExecutable(f *elf.File) (executable, pie bool) {
+	switch f.Type {
+	case elf.ET_EXEC:
+		return true, false
+	case elf.ET_DYN:
+		for _, prog := range f.Progs {
+			if prog.Type == elf.PT_INTERP {
+				return true, true
+			}
+		}
+		if flags, err := f.DynValue(elf.DT_FLAGS_1); err == nil && len(flags) > 0 && flags[0]&uint64(elf.DF_1_PIE) != 0 {
+			return true, true
+		}
+	}
+	return false, false
+}
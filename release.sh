@@ -1,5 +1,5 @@
 #!/bin/sh
 ver=$(git describe --tags)
 mkdir -p "cdetect-$ver"
-cp -rv main.go LICENSE README.md "cdetect-$ver"
+cp -rv *.go detect go.mod go.sum rustc-releases.txt advisories.txt LICENSE README.md "cdetect-$ver"
 tar Jcvf "cdetect-$ver.tar.xz" "cdetect-$ver"
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxSymlinks is how many symlinks may be followed when resolving a path, like the Linux kernel
+const maxSymlinks = 40
+
+// errTooManySymlinks is returned when a path has too many levels of symlinks
+var errTooManySymlinks = errors.New("too many levels of symbolic links")
+
+// rootFS resolves paths within a root directory, like a mounted image or a sysroot.
+// Symlinks are resolved as if the root directory was /, so that absolute symlinks
+// within an image point to files in the image, not to files on the host.
+// An empty rootFS resolves paths on the host.
+type rootFS struct {
+	dir string
+}
+
+// resolve returns the path on the host for the given absolute path within the root
+// directory, with all symlinks resolved within the root directory. An error that wraps
+// fs.ErrNotExist is returned if a component of the path does not exist.
+func (root rootFS) resolve(p string) (string, error) {
+	if root.dir == "" {
+		return p, nil
+	}
+	var (
+		resolved  = "/" // the part that has been resolved so far, within the root directory
+		remaining = strings.Split(strings.TrimPrefix(path.Clean("/"+p), "/"), "/")
+		links     = 0
+	)
+	for len(remaining) > 0 {
+		component := remaining[0]
+		remaining = remaining[1:]
+		if component == "" || component == "." {
+			continue
+		}
+		if component == ".." {
+			// Cleaning the path makes sure that ".." never leaves the root directory
+			resolved = path.Dir(resolved)
+			continue
+		}
+		next := path.Join(resolved, component)
+		fi, err := os.Lstat(filepath.Join(root.dir, next))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// The remaining components may have ".." from a symlink target, that can not
+				// be resolved from a directory that does not exist, so they are not used
+				return "", &fs.PathError{Op: "resolve", Path: p, Err: fs.ErrNotExist}
+			}
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return "", errors.New(p + ": " + errTooManySymlinks.Error())
+		}
+		target, err := os.Readlink(filepath.Join(root.dir, next))
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(target, "/") {
+			resolved = "/"
+		}
+		remaining = append(strings.Split(target, "/"), remaining...)
+	}
+	return filepath.Join(root.dir, resolved), nil
+}
+
+// exists checks if the given path exists within the root directory
+func (root rootFS) exists(p string) bool {
+	hostPath, err := root.resolve(p)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(hostPath)
+	return err == nil
+}
+
+// isExecutable checks if the given file mode has any of the executable bits set
+func isExecutable(mode os.FileMode) bool {
+	return mode.IsRegular() && mode&0o111 != 0
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRootResolve(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	for _, d := range []string{"root/usr/bin", "root/lib", "root/outside", "outside"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{"root/usr/bin/ls", "root/outside/secret", "outside/secret"} {
+		if err := os.WriteFile(filepath.Join(dir, f), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"root/bin":             "usr/bin",
+		"root/usr/bin/abs":     "/usr/bin/ls",
+		"root/lib/up":          "../../../../outside/secret",
+		"root/lib/missing":     "nothing/../../../outside/secret",
+		"root/lib/missing-dir": "nothing/../../..",
+		"root/lib/loop":        "loop",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tc := range []struct {
+		path string
+		want string // the path within the root directory, or an empty string for an error
+	}{
+		{"/bin/ls", "/usr/bin/ls"},
+		{"/usr/bin/abs", "/usr/bin/ls"},
+		{"/../../usr/bin/ls", "/usr/bin/ls"},
+		{"/lib/up", "/outside/secret"},
+		{"/lib/missing", ""},
+		{"/lib/missing-dir/outside/secret", ""},
+		{"/lib/nothing/../../outside/secret", "/outside/secret"},
+		{"/lib/loop", ""},
+	} {
+		got, err := rootFS{root}.resolve(tc.path)
+		switch {
+		case tc.want == "" && err == nil:
+			t.Errorf("%s: got %s, want an error", tc.path, got)
+		case tc.want != "" && err != nil:
+			t.Errorf("%s: %v", tc.path, err)
+		case tc.want != "" && got != filepath.Join(root, tc.want):
+			t.Errorf("%s: got %s, want %s", tc.path, got, filepath.Join(root, tc.want))
+		}
+		if err == nil && !strings.HasPrefix(got, root+string(filepath.Separator)) {
+			t.Errorf("%s: %s is outside of the root directory", tc.path, got)
+		}
+	}
+	if _, err := (rootFS{root}).resolve("/lib/missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got %v, want %v", err, fs.ErrNotExist)
+	}
+}
@@ -0,0 +1,12 @@
+#!/bin/sh
+# Regenerate rustc-releases.txt, with the full commit hashes of all stable rustc releases.
+# For annotated tags, the commit that the tag points to comes last, and is the one that is kept.
+set -e
+{
+  sed -n '/^#/p' rustc-releases.txt
+  git ls-remote --tags https://github.com/rust-lang/rust |
+    sed -n 's,^\([0-9a-f]\{40\}\)\trefs/tags/\([0-9]*\.[0-9]*\.[0-9]*\)\(\^{}\)\{0,1\}$,\2 \1,p' |
+    awk '{ hash[$1] = $2 } END { for (v in hash) print hash[v], v }' |
+    sort -k2 -V -r
+} > rustc-releases.txt.new
+mv rustc-releases.txt.new rustc-releases.txt
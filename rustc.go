@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"debug/elf"
+	_ "embed"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/xyproto/cdetect/detect"
+)
+
+// rustcReleasesData is the embedded list of rustc release commit hashes
+//
+//go:embed rustc-releases.txt
+var rustcReleasesData string
+
+// rustcRelease is a rustc release and the commit hash that it was built from
+type rustcRelease struct {
+	hash    string // may be abbreviated
+	version string
+}
+
+var (
+	rustcReleases     []rustcRelease
+	rustcReleasesOnce sync.Once
+)
+
+// parseRustcReleases parses "hash version" pairs, one per line. Empty lines and comments are skipped.
+func parseRustcReleases(r io.Reader) []rustcRelease {
+	var releases []rustcRelease
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		releases = append(releases, rustcRelease{hash: strings.ToLower(fields[0]), version: fields[1]})
+	}
+	return releases
+}
+
+// loadRustcReleases returns the known rustc releases. The releases in
+// ~/.config/cdetect/rustc-releases.txt, if it exists, come before the embedded ones.
+func loadRustcReleases() []rustcRelease {
+	rustcReleasesOnce.Do(func() {
+		if configDir, err := os.UserConfigDir(); err == nil {
+			if f, err := os.Open(filepath.Join(configDir, "cdetect", "rustc-releases.txt")); err == nil {
+				rustcReleases = parseRustcReleases(f)
+				f.Close()
+			}
+		}
+		rustcReleases = append(rustcReleases, parseRustcReleases(strings.NewReader(rustcReleasesData))...)
+	})
+	return rustcReleases
+}
+
+// rustcVersion returns the compiler for the given rustc commit hash, like "Rust 1.75.0".
+// Commits that are not in the list of releases are reported as unknown, with the full hash,
+// since they may be nightlies, or releases that are newer than the list.
+func rustcVersion(hash string) string {
+	for _, release := range loadRustcReleases() {
+		if len(release.hash) >= 7 && strings.HasPrefix(hash, release.hash) {
+			return "Rust " + release.version
+		}
+	}
+	return "Rust (unknown rustc commit " + hash + ")"
+}
+
+// findRustcCommit searches the data that can be read from r for the paths to the Rust
+// standard library source that are embedded in panic location strings, like
+// "/rustc/82e1608dfa6e0b5569232559e3d385fea5a93112/library/core/src/panicking.rs",
+// and returns the commit hash, or an empty string. The search stops when the context is done.
+func findRustcCommit(ctx context.Context, r io.Reader) string {
+	bufferSize := 8192
+	sr, err := detect.NewStreamReader(ctx, r, bufferSize)
+	if err != nil {
+		return ""
+	}
+	for {
+		b, err := sr.Next()
+		if err != nil {
+			return ""
+		}
+		if m := rustcCommitRegex.FindSubmatch(b); m != nil {
+			return string(m[1])
+		}
+	}
+}
+
+// rustVerCommit returns the rustc version of the given Rust ELF file from the rustc commit hash
+// in the .rodata section, or in the segments that are not executable if there are no section
+// headers. An empty string is returned if no commit hash could be found.
+func rustVerCommit(ctx context.Context, r io.ReaderAt, f *elf.File) string {
+	var hash string
+	if sec := f.Section(".rodata"); sec != nil && sec.Type != elf.SHT_NOBITS {
+		hash = findRustcCommit(ctx, io.NewSectionReader(r, int64(sec.Offset), int64(sec.FileSize)))
+	} else {
+		for _, prog := range f.Progs {
+			if prog.Type == elf.PT_LOAD && prog.Flags&elf.PF_X == 0 {
+				if hash = findRustcCommit(ctx, prog.Open()); hash != "" {
+					break
+				}
+			}
+		}
+	}
+	if hash == "" {
+		return ""
+	}
+	return rustcVersion(hash)
+}
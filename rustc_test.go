@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRustcVersion(t *testing.T) {
+	for hash, want := range map[string]string{
+		"82e1608dfa6e0b5569232559e3d385fea5a93112": "Rust 1.75.0",
+		"8460ca823e8367a30dda430efda790588b8c84d3": "Rust 1.68.1",
+		"1159e78c4747b02ef996e55082b704c09b970588": "Rust 1.90.0",
+		"0000000000000000000000000000000000000000": "Rust (unknown rustc commit 0000000000000000000000000000000000000000)",
+	} {
+		if got := rustcVersion(hash); got != want {
+			t.Errorf("%s: got %q, want %q", hash, got, want)
+		}
+	}
+}
+
+// TestRustcReleases checks that every line of the embedded list of releases is used, and that
+// every version is listed once
+func TestRustcReleases(t *testing.T) {
+	releases := parseRustcReleases(strings.NewReader(rustcReleasesData))
+	lines := 0
+	for _, line := range strings.Split(rustcReleasesData, "\n") {
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines++
+		}
+	}
+	if len(releases) != lines {
+		t.Errorf("got %d releases from %d lines", len(releases), lines)
+	}
+	seen := make(map[string]bool)
+	for _, release := range releases {
+		if seen[release.version] {
+			t.Errorf("%s is listed more than once", release.version)
+		}
+		seen[release.version] = true
+		if len(release.hash) < 7 || strings.Trim(release.hash, "0123456789abcdef") != "" {
+			t.Errorf("%s: invalid commit hash %q", release.version, release.hash)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// The IDs of the SARIF rules, in addition to the rules of the findings ("eol", "advisory" and "policy")
+const (
+	ruleUnknownCompiler = "unknown-compiler"
+	ruleNotPIE          = "not-pie"
+	ruleNoRELRO         = "no-relro"
+	ruleExecStack       = "executable-stack"
+	ruleError           = "error"
+)
+
+// sarifRules are the rules that SARIF results can refer to, in the order they are listed
+var sarifRules = []struct{ id, level, description string }{
+	{"eol", levelWarning, "The compiler is end-of-life"},
+	{"advisory", levelError, "The compiler has a known advisory"},
+	{"policy", levelError, "A policy rule is violated"},
+	{ruleUnknownCompiler, levelWarning, "The compiler could not be detected"},
+	{ruleNotPIE, levelWarning, "The executable is not position independent"},
+	{ruleNoRELRO, levelNote, "The executable has no read-only relocations (RELRO)"},
+	{ruleExecStack, levelWarning, "The executable requests an executable stack"},
+	{ruleError, levelError, "The file could not be examined"},
+}
+
+// SARIF 2.1.0
+
+type sarifText struct {
+	Text string `json:"text"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifText          `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation  `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID     string            `json:"ruleId"`
+	RuleIndex  int               `json:"ruleIndex"`
+	Level      string            `json:"level"`
+	Message    sarifText         `json:"message"`
+	Locations  []sarifLocation   `json:"locations"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+// sarifReport collects the SARIF results for all examined files, since
+// there is only one SARIF log, even when several files are examined
+type sarifReport struct {
+	results []sarifResult
+}
+
+// sarifArtifact returns the artifact location of the given file. Relative paths
+// are relative to the source root, and absolute paths are file URIs.
+func sarifArtifact(filename string) sarifArtifactLocation {
+	if filepath.IsAbs(filename) {
+		return sarifArtifactLocation{URI: (&url.URL{Scheme: "file", Path: filename}).String()}
+	}
+	return sarifArtifactLocation{URI: (&url.URL{Path: filepath.ToSlash(filename)}).String(), URIBaseID: "%SRCROOT%"}
+}
+
+// addResult adds a SARIF result for the given rule, for the given file and result
+func (sr *sarifReport) addResult(filename string, res *result, ruleID, level, message string, properties map[string]string) {
+	ruleIndex := 0
+	for i, rule := range sarifRules {
+		if rule.id == ruleID {
+			ruleIndex = i
+			break
+		}
+	}
+	location := sarifLocation{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifact(filename)}}
+	if res != nil && res.name != "" {
+		name := res.name
+		if res.group != "" {
+			name = res.group + "/" + strings.TrimPrefix(res.name, "/")
+		}
+		location.LogicalLocations = []sarifLogicalLocation{{Name: res.name, FullyQualifiedName: name}}
+		message = res.name + ": " + message
+	}
+	if res != nil && res.compiler != "" {
+		if properties == nil {
+			properties = make(map[string]string)
+		}
+		properties["compiler"] = res.compiler
+	}
+	sr.results = append(sr.results, sarifResult{
+		RuleID:     ruleID,
+		RuleIndex:  ruleIndex,
+		Level:      level,
+		Message:    sarifText{message},
+		Locations:  []sarifLocation{location},
+		Properties: properties,
+	})
+}
+
+// add adds SARIF results for the results of examining the given file: the findings
+// from --check and --policy, unknown compilers, missing hardening and errors
+func (sr *sarifReport) add(filename string, results []result) {
+	for i := range results {
+		res := &results[i]
+		if res.err != nil {
+			sr.addResult(filename, res, ruleError, levelError, res.err.Error(), nil)
+			continue
+		}
+		for _, fi := range res.findings {
+			sr.addResult(filename, res, fi.rule, fi.level, fi.message, map[string]string{"id": fi.id})
+		}
+		if parseTool(res.compiler).name == "unknown" {
+			sr.addResult(filename, res, ruleUnknownCompiler, levelWarning, "the compiler could not be detected", nil)
+		}
+		d := res.details
+		if d == nil || !d.executable {
+			continue
+		}
+		if !d.pie {
+			sr.addResult(filename, res, ruleNotPIE, levelWarning, "not a position independent executable", nil)
+		}
+		if !d.relro {
+			sr.addResult(filename, res, ruleNoRELRO, levelNote, "no read-only relocations (RELRO)", nil)
+		}
+		if d.execStack {
+			sr.addResult(filename, res, ruleExecStack, levelWarning, "requests an executable stack", nil)
+		}
+	}
+}
+
+// addError adds a SARIF result for a file that could not be examined
+func (sr *sarifReport) addError(filename string, err error) {
+	sr.addResult(filename, nil, ruleError, levelError, err.Error(), nil)
+}
+
+// write writes the SARIF log, with all the results that have been added
+func (sr *sarifReport) write(w io.Writer) error {
+	driver := sarifDriver{
+		Name:           "cdetect",
+		Version:        strings.TrimPrefix(versionString, "cdetect "),
+		InformationURI: "https://github.com/xyproto/cdetect",
+	}
+	for _, rule := range sarifRules {
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   rule.id,
+			ShortDescription:     sarifText{rule.description},
+			DefaultConfiguration: sarifConfiguration{rule.level},
+		})
+	}
+	results := sr.results
+	if results == nil {
+		results = []sarifResult{}
+	}
+	return writeJSON(w, sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	})
+}
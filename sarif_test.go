@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSARIF(t *testing.T) {
+	sr := &sarifReport{}
+	sr.add("bin/app", []result{
+		{compiler: "Go 1.19.13", details: &details{executable: true, pie: true, relro: true}, findings: []finding{
+			{rule: "eol", id: "eol", level: levelWarning, message: "Go 1.19.13 is end-of-life"},
+		}},
+	})
+	sr.add("/usr/lib/x.a", []result{
+		{name: "x.o", compiler: "unknown"},
+		{name: "y.o", err: errors.New("not an ELF file")},
+	})
+	sr.add("image.tar", []result{
+		{name: "/usr/bin/a", group: "alpine:3.19", compiler: "GCC 13.2.1", details: &details{executable: true, execStack: true}},
+	})
+	sr.addError("missing", errors.New("no such file"))
+
+	var buf bytes.Buffer
+	if err := sr.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("got version %q with %d runs", log.Version, len(log.Runs))
+	}
+	run := log.Runs[0]
+	type summary struct {
+		rule, level, message, uri, base, logical string
+	}
+	var got []summary
+	for _, res := range run.Results {
+		if res.RuleIndex < 0 || res.RuleIndex >= len(run.Tool.Driver.Rules) || run.Tool.Driver.Rules[res.RuleIndex].ID != res.RuleID {
+			t.Errorf("%s: wrong rule index %d", res.RuleID, res.RuleIndex)
+		}
+		s := summary{rule: res.RuleID, level: res.Level, message: res.Message.Text}
+		if len(res.Locations) == 1 {
+			s.uri = res.Locations[0].PhysicalLocation.ArtifactLocation.URI
+			s.base = res.Locations[0].PhysicalLocation.ArtifactLocation.URIBaseID
+			if logical := res.Locations[0].LogicalLocations; len(logical) == 1 {
+				s.logical = logical[0].FullyQualifiedName
+			}
+		}
+		got = append(got, s)
+	}
+	want := []summary{
+		{"eol", levelWarning, "Go 1.19.13 is end-of-life", "bin/app", "%SRCROOT%", ""},
+		{ruleUnknownCompiler, levelWarning, "x.o: the compiler could not be detected", "file:///usr/lib/x.a", "", "x.o"},
+		{ruleError, levelError, "y.o: not an ELF file", "file:///usr/lib/x.a", "", "y.o"},
+		{ruleNotPIE, levelWarning, "/usr/bin/a: not a position independent executable", "image.tar", "%SRCROOT%", "alpine:3.19/usr/bin/a"},
+		{ruleNoRELRO, levelNote, "/usr/bin/a: no read-only relocations (RELRO)", "image.tar", "%SRCROOT%", "alpine:3.19/usr/bin/a"},
+		{ruleExecStack, levelWarning, "/usr/bin/a: requests an executable stack", "image.tar", "%SRCROOT%", "alpine:3.19/usr/bin/a"},
+		{ruleError, levelError, "no such file", "missing", "%SRCROOT%", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+	if compiler := run.Results[0].Properties["compiler"]; compiler != "Go 1.19.13" {
+		t.Errorf("got the compiler %q, want %q", compiler, "Go 1.19.13")
+	}
+
+	// A report without results still has a list of results, as SARIF requires
+	buf.Reset()
+	if err := (&sarifReport{}).write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"results": []`) {
+		t.Errorf("no empty list of results in %s", buf.String())
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The roles of the packages in an SBOM, in relation to the files that were examined
+const (
+	roleCompiler   = "compiler"
+	roleLinker     = "linker"
+	roleRuntime    = "runtime"
+	roleGoModule   = "go-module"
+	roleCrate      = "crate"
+	roleBuildCrate = "build-crate"
+)
+
+// spdxIDRegex matches the characters that are not allowed in SPDX identifiers
+var spdxIDRegex = regexp.MustCompile(`[^a-zA-Z0-9.-]`)
+
+// sbomPackage is a compiler, linker, language runtime, Go module or Rust crate in an SBOM
+type sbomPackage struct {
+	ref     string
+	role    string
+	name    string
+	version string
+	purl    string
+}
+
+// sbomFile is an examined file in an SBOM, and the packages that it was built with
+type sbomFile struct {
+	ref      string
+	res      *result
+	name     string
+	packages []*sbomPackage
+}
+
+// sbom is a format independent software bill of materials, for the examined file
+// and every ELF file within it
+type sbom struct {
+	name     string
+	sha1     string
+	sha256   string
+	serial   string
+	created  string
+	files    []*sbomFile
+	packages []*sbomPackage
+	index    map[string]*sbomPackage
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b)
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// add adds the given package to the SBOM, unless it has already been added, and returns it
+func (s *sbom) add(role, name, version, purl string) *sbomPackage {
+	key := role + " " + name + " " + version
+	if p, ok := s.index[key]; ok {
+		return p
+	}
+	p := &sbomPackage{ref: "package-" + strconv.Itoa(len(s.packages)+1), role: role, name: name, version: version, purl: purl}
+	s.index[key] = p
+	s.packages = append(s.packages, p)
+	return p
+}
+
+// newSBOM creates an SBOM for the given file, at the given path on the host, from the results
+// of examining it. Results that are errors, like files that are not ELF files, are left out.
+func newSBOM(filename, hostPath string, results []result) *sbom {
+	s := &sbom{
+		name:    filename,
+		serial:  newUUID(),
+		created: time.Now().UTC().Format(time.RFC3339),
+		index:   make(map[string]*sbomPackage),
+	}
+	if f, err := os.Open(hostPath); err == nil {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			s.sha1, s.sha256, _ = hashes(f, fi.Size())
+		}
+		f.Close()
+	}
+	for i := range results {
+		res := &results[i]
+		if res.err != nil {
+			continue
+		}
+		file := &sbomFile{ref: "file-" + strconv.Itoa(len(s.files)+1), res: res, name: res.name}
+		if file.name == "" {
+			file.name = filename
+		}
+		if res.compiler != "" && res.compiler != "unknown" {
+			compiler := parseTool(res.compiler)
+			file.packages = append(file.packages, s.add(roleCompiler, compiler.name, compiler.version, ""))
+		}
+		if d := res.details; d != nil {
+			if d.linker != nil {
+				file.packages = append(file.packages, s.add(roleLinker, d.linker.name, d.linker.version, ""))
+			}
+			for _, runtime := range d.runtimes {
+				file.packages = append(file.packages, s.add(roleRuntime, runtime.name, runtime.version, ""))
+			}
+			if d.goBuild != nil {
+				for _, mod := range d.goBuild.Deps {
+					if mod.Replace != nil {
+						mod = mod.Replace
+					}
+					purl := "pkg:golang/" + mod.Path + "@" + mod.Version
+					file.packages = append(file.packages, s.add(roleGoModule, mod.Path, mod.Version, purl))
+				}
+			}
+			for _, c := range d.crates {
+				if c.Root {
+					continue
+				}
+				role := roleCrate
+				if c.Kind == "build" {
+					role = roleBuildCrate
+				}
+				purl := "pkg:cargo/" + c.Name + "@" + c.Version
+				file.packages = append(file.packages, s.add(role, c.Name, c.Version, purl))
+			}
+		}
+		s.files = append(s.files, file)
+	}
+	return s
+}
+
+// writeJSON writes the given value as indented JSON
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
+
+// CycloneDX 1.5 JSON
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxComponent struct {
+	Type       string        `json:"type"`
+	BOMRef     string        `json:"bom-ref,omitempty"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version,omitempty"`
+	Scope      string        `json:"scope,omitempty"`
+	Hashes     []cdxHash     `json:"hashes,omitempty"`
+	PURL       string        `json:"purl,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+type cdxMetadata struct {
+	Timestamp string `json:"timestamp"`
+	Tools     struct {
+		Components []cdxComponent `json:"components"`
+	} `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxBOM struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+}
+
+// cdxHashes returns the CycloneDX hashes for the given checksums, if they are known
+func cdxHashes(sha1, sha256 string) []cdxHash {
+	if sha256 == "" {
+		return nil
+	}
+	return []cdxHash{{Alg: "SHA-1", Content: sha1}, {Alg: "SHA-256", Content: sha256}}
+}
+
+// writeCycloneDX writes the given SBOM in the CycloneDX JSON format
+func writeCycloneDX(w io.Writer, s *sbom) error {
+	bom := cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + s.serial,
+		Version:      1,
+		Components:   []cdxComponent{},
+		Dependencies: []cdxDependency{},
+	}
+	bom.Metadata.Timestamp = s.created
+	name, version, _ := strings.Cut(versionString, " ")
+	bom.Metadata.Tools.Components = []cdxComponent{{Type: "application", Name: name, Version: version}}
+	bom.Metadata.Component = cdxComponent{Type: "file", BOMRef: "input", Name: s.name, Hashes: cdxHashes(s.sha1, s.sha256)}
+	input := cdxDependency{Ref: "input", DependsOn: []string{}}
+	for _, file := range s.files {
+		c := cdxComponent{Type: "file", BOMRef: file.ref, Name: file.name}
+		if d := file.res.details; d != nil {
+			c.Hashes = cdxHashes(d.sha1, d.sha256)
+		}
+		c.Properties = append(c.Properties, cdxProperty{Name: "cdetect:compiler", Value: file.res.String()})
+		if file.res.group != "" {
+			c.Properties = append(c.Properties, cdxProperty{Name: "cdetect:group", Value: file.res.group})
+		}
+		bom.Components = append(bom.Components, c)
+		input.DependsOn = append(input.DependsOn, file.ref)
+		dep := cdxDependency{Ref: file.ref, DependsOn: []string{}}
+		for _, p := range file.packages {
+			dep.DependsOn = append(dep.DependsOn, p.ref)
+		}
+		bom.Dependencies = append(bom.Dependencies, dep)
+	}
+	bom.Dependencies = append([]cdxDependency{input}, bom.Dependencies...)
+	for _, p := range s.packages {
+		c := cdxComponent{Type: "library", BOMRef: p.ref, Name: p.name, Version: p.version, PURL: p.purl, Scope: "required"}
+		switch p.role {
+		case roleCompiler, roleLinker:
+			// Build tools are not part of the examined files
+			c.Type, c.Scope = "application", "excluded"
+		case roleBuildCrate:
+			c.Scope = "excluded"
+		}
+		c.Properties = []cdxProperty{{Name: "cdetect:role", Value: p.role}}
+		bom.Components = append(bom.Components, c)
+		bom.Dependencies = append(bom.Dependencies, cdxDependency{Ref: p.ref, DependsOn: []string{}})
+	}
+	return writeJSON(w, bom)
+}
+
+// SPDX 2.3 JSON
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxPackage struct {
+	SPDXID                string            `json:"SPDXID"`
+	Name                  string            `json:"name"`
+	VersionInfo           string            `json:"versionInfo,omitempty"`
+	DownloadLocation      string            `json:"downloadLocation"`
+	FilesAnalyzed         bool              `json:"filesAnalyzed"`
+	Checksums             []spdxChecksum    `json:"checksums,omitempty"`
+	PrimaryPackagePurpose string            `json:"primaryPackagePurpose,omitempty"`
+	ExternalRefs          []spdxExternalRef `json:"externalRefs,omitempty"`
+	Comment               string            `json:"comment,omitempty"`
+}
+
+type spdxFile struct {
+	SPDXID    string         `json:"SPDXID"`
+	FileName  string         `json:"fileName"`
+	Checksums []spdxChecksum `json:"checksums"`
+	FileTypes []string       `json:"fileTypes"`
+	Comment   string         `json:"comment,omitempty"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+type spdxDocument struct {
+	SPDXVersion       string `json:"spdxVersion"`
+	DataLicense       string `json:"dataLicense"`
+	SPDXID            string `json:"SPDXID"`
+	Name              string `json:"name"`
+	DocumentNamespace string `json:"documentNamespace"`
+	CreationInfo      struct {
+		Created  string   `json:"created"`
+		Creators []string `json:"creators"`
+	} `json:"creationInfo"`
+	Packages      []spdxPackage      `json:"packages"`
+	Files         []spdxFile         `json:"files"`
+	Relationships []spdxRelationship `json:"relationships"`
+}
+
+// spdxID returns an SPDX identifier for the given reference
+func spdxID(ref string) string {
+	return "SPDXRef-" + spdxIDRegex.ReplaceAllString(ref, "-")
+}
+
+// spdxChecksums returns the SPDX checksums for the given checksums, if they are known
+func spdxChecksums(sha1, sha256 string) []spdxChecksum {
+	if sha256 == "" {
+		return nil
+	}
+	return []spdxChecksum{{Algorithm: "SHA1", ChecksumValue: sha1}, {Algorithm: "SHA256", ChecksumValue: sha256}}
+}
+
+// writeSPDX writes the given SBOM in the SPDX JSON format, with the input as a package
+// that contains every examined ELF file, and the compilers, linkers, runtimes and crates
+// as packages that the files are related to.
+func writeSPDX(w io.Writer, s *sbom) error {
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              s.name,
+		DocumentNamespace: "https://spdx.org/spdxdocs/cdetect-" + s.serial,
+		Packages:          []spdxPackage{},
+		Files:             []spdxFile{},
+		Relationships:     []spdxRelationship{},
+	}
+	doc.CreationInfo.Created = s.created
+	doc.CreationInfo.Creators = []string{"Tool: " + strings.Replace(versionString, " ", "-", 1)}
+	inputID := spdxID("input")
+	doc.Packages = append(doc.Packages, spdxPackage{
+		SPDXID:           inputID,
+		Name:             s.name,
+		DownloadLocation: "NOASSERTION",
+		Checksums:        spdxChecksums(s.sha1, s.sha256),
+	})
+	doc.Relationships = append(doc.Relationships, spdxRelationship{"SPDXRef-DOCUMENT", "DESCRIBES", inputID})
+	for _, p := range s.packages {
+		pkg := spdxPackage{
+			SPDXID:                spdxID(p.ref),
+			Name:                  p.name,
+			VersionInfo:           p.version,
+			DownloadLocation:      "NOASSERTION",
+			PrimaryPackagePurpose: "LIBRARY",
+			Comment:               fmt.Sprintf("cdetect:role %s", p.role),
+		}
+		if p.role == roleCompiler || p.role == roleLinker {
+			pkg.PrimaryPackagePurpose = "APPLICATION"
+		}
+		if p.purl != "" {
+			pkg.ExternalRefs = []spdxExternalRef{{"PACKAGE-MANAGER", "purl", p.purl}}
+		}
+		doc.Packages = append(doc.Packages, pkg)
+	}
+	for _, file := range s.files {
+		d := file.res.details
+		if d == nil {
+			continue
+		}
+		id := spdxID(file.ref)
+		doc.Files = append(doc.Files, spdxFile{
+			SPDXID:    id,
+			FileName:  file.name,
+			Checksums: spdxChecksums(d.sha1, d.sha256),
+			FileTypes: []string{"BINARY"},
+			Comment:   "cdetect:compiler " + file.res.String(),
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{inputID, "CONTAINS", id})
+		for _, p := range file.packages {
+			switch p.role {
+			case roleCompiler, roleLinker:
+				doc.Relationships = append(doc.Relationships, spdxRelationship{spdxID(p.ref), "BUILD_TOOL_OF", id})
+			case roleBuildCrate:
+				doc.Relationships = append(doc.Relationships, spdxRelationship{spdxID(p.ref), "BUILD_DEPENDENCY_OF", id})
+			case roleRuntime:
+				doc.Relationships = append(doc.Relationships, spdxRelationship{id, "DEPENDS_ON", spdxID(p.ref)})
+			default:
+				doc.Relationships = append(doc.Relationships, spdxRelationship{id, "STATIC_LINK", spdxID(p.ref)})
+			}
+		}
+	}
+	return writeJSON(w, doc)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestExamineDetailsChecksums(t *testing.T) {
+	data := testELF()
+	for _, checksums := range []bool{false, true} {
+		e := &examination{ctx: context.Background(), checksums: checksums}
+		d, err := examineDetails(e, bytes.NewReader(data), int64(len(data)), "GCC 13.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (d.sha256 != "") != checksums || (d.sha1 != "") != checksums {
+			t.Errorf("checksums %v: got sha1 %q and sha256 %q", checksums, d.sha1, d.sha256)
+		}
+	}
+}
+
+func TestSBOM(t *testing.T) {
+	results := []result{
+		{name: "a", compiler: "GCC 13.2.1", details: &details{sha1: "da39", sha256: "e3b0", linker: &tool{name: "GNU ld", version: "2.41"}}},
+		{name: "b", compiler: "GCC 13.2.1", details: &details{linker: &tool{name: "GNU ld", version: "2.41"}, crates: []crate{
+			{Name: "app", Version: "0.1.0", Root: true, Dependencies: []int{1, 2}},
+			{Name: "serde", Version: "1.0.188"},
+			{Name: "cc", Version: "1.0.83", Kind: "build"},
+		}}},
+		{name: "c", err: errors.New("not an ELF file")},
+	}
+	s := newSBOM("input.tar", "", results)
+	if len(s.files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(s.files))
+	}
+	// The compiler and the linker are shared by both files, the root crate is left out
+	if len(s.packages) != 4 {
+		t.Errorf("expected 4 packages, got %d", len(s.packages))
+	}
+
+	var cdx bytes.Buffer
+	if err := writeCycloneDX(&cdx, s); err != nil {
+		t.Fatal(err)
+	}
+	var bom cdxBOM
+	if err := json.Unmarshal(cdx.Bytes(), &bom); err != nil {
+		t.Fatal(err)
+	}
+	if len(bom.Components) != 6 || len(bom.Dependencies) != 7 {
+		t.Errorf("expected 6 components and 7 dependencies, got %d and %d", len(bom.Components), len(bom.Dependencies))
+	}
+	if len(bom.Components[0].Hashes) != 2 || bom.Components[1].Hashes != nil {
+		t.Errorf("expected hashes only for the file with checksums, got %+v and %+v", bom.Components[0].Hashes, bom.Components[1].Hashes)
+	}
+	for _, c := range bom.Components {
+		if c.Name == "cc" && c.Scope != "excluded" {
+			t.Errorf("expected the build crate to be excluded, got %q", c.Scope)
+		}
+	}
+
+	var spdx bytes.Buffer
+	if err := writeSPDX(&spdx, s); err != nil {
+		t.Fatal(err)
+	}
+	var doc spdxDocument
+	if err := json.Unmarshal(spdx.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Files) != 2 || len(doc.Packages) != 5 {
+		t.Errorf("expected 2 files and 5 packages, got %d and %d", len(doc.Files), len(doc.Packages))
+	}
+	ids := make(map[string]bool)
+	for _, p := range doc.Packages {
+		ids[p.SPDXID] = true
+	}
+	for _, f := range doc.Files {
+		ids[f.SPDXID] = true
+	}
+	for _, r := range doc.Relationships {
+		if r.SPDXElementID != "SPDXRef-DOCUMENT" && !ids[r.SPDXElementID] || !ids[r.RelatedSPDXElement] {
+			t.Errorf("relationship with an unknown element: %+v", r)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// server examines uploaded files and local files on request, and returns the results as JSON
+type server struct {
+	root            rootFS
+	opts            options
+	maxSize         int64         // the largest upload that is accepted, in bytes
+	maxDecompressed int64         // how many bytes may be decompressed per request
+	slots           chan struct{} // one slot per file that can be examined concurrently
+	requests        atomic.Int64
+	failures        atomic.Int64 // requests where the file could not be examined
+	rejected        atomic.Int64 // requests that were too large, malformed or timed out
+	inFlight        atomic.Int64
+	uploaded        atomic.Int64 // the number of bytes that have been uploaded
+	durationSum     atomic.Int64 // in microseconds
+}
+
+// writeError writes a JSON error response with the given status code, and the kind of error
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	writeJSON(w, map[string]string{"error": err.Error(), "kind": errorKind(err)})
+}
+
+// handleExamine examines the file that is uploaded as the request body, or, if the
+// "path" query parameter is given, the local file with that path. The "name" query
+// parameter is used as the file name of uploads in the results.
+func (s *server) handleExamine(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("only POST is supported"))
+		return
+	}
+	s.requests.Add(1)
+	s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+	start := time.Now()
+	defer func() {
+		s.durationSum.Add(time.Since(start).Microseconds())
+	}()
+
+	// Wait for a free slot before reading the upload, unless the request is cancelled or times out
+	// first, so that no more than one upload per slot is in memory
+	select {
+	case s.slots <- struct{}{}:
+	case <-r.Context().Done():
+		s.rejected.Add(1)
+		writeError(w, http.StatusServiceUnavailable, errors.New("too many concurrent requests"))
+		return
+	}
+	defer func() { <-s.slots }()
+
+	filename := r.URL.Query().Get("path")
+	var data []byte
+	if filename == "" {
+		filename = r.URL.Query().Get("name")
+		if filename == "" {
+			filename = "upload"
+		}
+		var err error
+		data, err = io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxSize))
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesError):
+			s.rejected.Add(1)
+			writeError(w, http.StatusRequestEntityTooLarge, errors.New("the upload is larger than "+strconv.FormatInt(s.maxSize, 10)+" bytes"))
+			return
+		case err != nil:
+			s.rejected.Add(1)
+			writeError(w, http.StatusBadRequest, err)
+			return
+		case len(data) == 0:
+			s.rejected.Add(1)
+			writeError(w, http.StatusBadRequest, errors.New("expected a file as the request body, or a path query parameter"))
+			return
+		}
+		s.uploaded.Add(int64(len(data)))
+	}
+
+	var (
+		results []result
+		err     error
+		e       = &examination{ctx: r.Context(), root: s.root, maxDecompressed: s.maxDecompressed, checksums: true}
+	)
+	if data != nil {
+		results, err = examineBytes(e, data)
+	} else if filename, err = which(filename, s.root); err == nil {
+		_, results, err = examineFile(e, filename)
+	}
+	if r.Context().Err() != nil {
+		// The response is discarded, since the request timed out or was cancelled
+		s.rejected.Add(1)
+		return
+	}
+	if err != nil {
+		s.failures.Add(1)
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	s.opts.checkResults(results)
+	w.Header().Set("Content-Type", "application/json")
+	writeResultsJSON(w, filename, results)
+}
+
+// handleHealth reports that the server is up
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// handleMetrics writes the request counters in the Prometheus text format
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, m := range []struct {
+		name, kind, help string
+		value            string
+	}{
+		{"cdetect_requests_total", "counter", "The number of examine requests.", strconv.FormatInt(s.requests.Load(), 10)},
+		{"cdetect_request_failures_total", "counter", "The number of examine requests where the file could not be examined.", strconv.FormatInt(s.failures.Load(), 10)},
+		{"cdetect_requests_rejected_total", "counter", "The number of examine requests that were too large, malformed or not served in time.", strconv.FormatInt(s.rejected.Load(), 10)},
+		{"cdetect_requests_in_flight", "gauge", "The number of examine requests that are being served.", strconv.FormatInt(s.inFlight.Load(), 10)},
+		{"cdetect_uploaded_bytes_total", "counter", "The number of bytes that have been uploaded.", strconv.FormatInt(s.uploaded.Load(), 10)},
+		{"cdetect_request_duration_seconds_total", "counter", "The time spent serving examine requests.", strconv.FormatFloat(float64(s.durationSum.Load())/1e6, 'f', -1, 64)},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", m.name, m.help, m.name, m.kind, m.name, m.value)
+	}
+}
+
+// serve parses the command line arguments for "cdetect serve" and serves HTTP requests until it fails
+func serve(args []string) error {
+	var (
+		s               server
+		listen          string
+		timeout         time.Duration
+		maxSize         int64
+		maxDecompressed int64
+		workers         int
+		rootDir         string
+		policyFile      string
+		rulesDir        string
+		detectors       string
+	)
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Usage = usage
+	fs.StringVar(&listen, "listen", "127.0.0.1:8080", "the address to listen on")
+	fs.DurationVar(&timeout, "timeout", 30*time.Second, "the time limit per request")
+	fs.Int64Var(&maxSize, "max-size", 256*1024*1024, "the largest upload, in bytes")
+	fs.Int64Var(&maxDecompressed, "max-decompressed", maxDecompressedSize, "how many bytes may be decompressed per request")
+	fs.IntVar(&workers, "concurrency", runtime.NumCPU(), "the number of files that can be examined concurrently")
+	fs.StringVar(&rootDir, "root", "", "look up local files within this directory")
+	fs.BoolVar(&s.opts.check, "check", false, "check for end-of-life compilers and known advisories")
+	fs.StringVar(&policyFile, "policy", "", "check files against the rules in this policy file")
+	fs.StringVar(&detectors, "detectors", "", "only use these compiler detectors")
+	fs.StringVar(&rulesDir, "rules", "", "load compiler detection rules from this directory")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		return errors.New("unexpected argument: " + fs.Arg(0))
+	}
+	if workers < 1 || maxSize < 1 || maxDecompressed < 1 || timeout <= 0 {
+		return errors.New("--concurrency, --max-size, --max-decompressed and --timeout must be positive")
+	}
+	if err := setupDetectors(rulesDir, detectors); err != nil {
+		return err
+	}
+	var err error
+	if s.opts.check {
+		if s.opts.advisories, err = loadAdvisories(); err != nil {
+			return err
+		}
+	}
+	if policyFile != "" {
+		if s.opts.policy, err = loadPolicy(policyFile); err != nil {
+			return err
+		}
+	}
+	s.root = rootFS{rootDir}
+	s.maxSize = maxSize
+	s.maxDecompressed = maxDecompressed
+	s.slots = make(chan struct{}, workers)
+
+	timeoutError, _ := json.Marshal(map[string]string{"error": "the request took longer than " + timeout.String()})
+	examine := http.TimeoutHandler(http.HandlerFunc(s.handleExamine), timeout, string(timeoutError))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/examine", func(w http.ResponseWriter, r *http.Request) {
+		// The timeout response is JSON too. Other responses set their own headers.
+		w.Header().Set("Content-Type", "application/json")
+		examine.ServeHTTP(w, r)
+	})
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	srv := &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	fmt.Fprintln(os.Stderr, "listening on "+listen)
+	return srv.ListenAndServe()
+}
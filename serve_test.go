@@ -0,0 +1,54 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleExamine(t *testing.T) {
+	exe := testELF()
+	s := &server{maxSize: 1 << 20, maxDecompressed: 1 << 20, slots: make(chan struct{}, 1)}
+	for _, tc := range []struct {
+		name   string
+		method string
+		query  string
+		body   []byte
+		status int
+		want   string // a part of the response
+	}{
+		{"upload", http.MethodPost, "?name=app", exe, http.StatusOK, `"file": "app"`},
+		{"upload without a name", http.MethodPost, "", testTar(t, []testEntry{{"bin/a", tar.TypeReg, string(exe)}}), http.StatusOK, `"name": "/bin/a"`},
+		{"checksums", http.MethodPost, "", exe, http.StatusOK, `"sha256": "`},
+		{"GET", http.MethodGet, "", nil, http.StatusMethodNotAllowed, `"error": "only POST is supported"`},
+		{"no body", http.MethodPost, "", nil, http.StatusBadRequest, `"error": "expected a file as the request body, or a path query parameter"`},
+		{"too large", http.MethodPost, "", make([]byte, 1<<20+1), http.StatusRequestEntityTooLarge, `"error": "the upload is larger than 1048576 bytes"`},
+		{"decompressed too much", http.MethodPost, "", testGzip(t, append(exe, make([]byte, 2<<20)...)), http.StatusUnprocessableEntity, `"kind": "too-large"`},
+		{"not an ELF file", http.MethodPost, "", []byte("not an executable"), http.StatusUnprocessableEntity, `"kind": "not-elf"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.handleExamine(w, httptest.NewRequest(tc.method, "/examine"+tc.query, bytes.NewReader(tc.body)))
+			if w.Code != tc.status {
+				t.Errorf("got the status %d, want %d", w.Code, tc.status)
+			}
+			if !json.Valid(w.Body.Bytes()) || w.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("not a JSON response: %s", w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tc.want) {
+				t.Errorf("%s does not contain %s", w.Body.String(), tc.want)
+			}
+		})
+	}
+	w := httptest.NewRecorder()
+	s.handleMetrics(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{"cdetect_requests_total 7\n", "cdetect_request_failures_total 2\n", "cdetect_requests_rejected_total 2\n", "cdetect_requests_in_flight 0\n"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("the metrics do not contain %q:\n%s", want, w.Body.String())
+		}
+	}
+}
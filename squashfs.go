@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/xi2/xz"
+)
+
+// A minimal, read-only SquashFS 4.0 reader, for finding the ELF files in
+// AppImage payloads, snap packages and other SquashFS images.
+
+const (
+	squashfsMagic          = "hsqs"
+	squashfsSuperblockSize = 96
+	squashfsMetadataSize   = 8192
+	squashfsNoFragment     = 0xffffffff
+	squashfsUncompressed   = 1 << 24
+	squashfsMaxDepth       = 64
+
+	squashfsGzip = 1
+	squashfsXz   = 4
+	squashfsLz4  = 5
+	squashfsZstd = 6
+
+	squashfsBasicDir  = 1
+	squashfsBasicFile = 2
+	squashfsExtDir    = 8
+	squashfsExtFile   = 9
+)
+
+// squashfs is an opened SquashFS image
+type squashfs struct {
+	r                io.ReaderAt
+	size             int64
+	blockSize        uint32
+	compressor       uint16
+	fragmentCount    uint32
+	rootInode        uint64
+	inodeTable       int64
+	directoryTable   int64
+	fragmentTable    int64
+	zstdDecoder      *zstd.Decoder
+	fragmentCache    map[uint32][]byte
+	lastFragmentRead uint32
+}
+
+// squashfsInode is the part of a directory or regular file inode that is needed for reading it
+type squashfsInode struct {
+	kind uint16
+	// For directories
+	dirBlock  uint32
+	dirOffset uint16
+	dirSize   uint32
+	// For regular files
+	blocksStart    uint64
+	fileSize       uint64
+	fragmentIndex  uint32
+	fragmentOffset uint32
+	blockSizes     []uint32
+}
+
+// squashfsEntry is a directory entry
+type squashfsEntry struct {
+	name  string
+	inode uint64
+}
+
+// isSquashfs checks if the given data starts with the magic bytes of a SquashFS image
+func isSquashfs(r io.ReaderAt) bool {
+	magic := make([]byte, len(squashfsMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		return false
+	}
+	return string(magic) == squashfsMagic
+}
+
+// openSquashfs reads the superblock of the SquashFS image that can be read from r
+func openSquashfs(r io.ReaderAt, size int64) (*squashfs, error) {
+	sb := make([]byte, squashfsSuperblockSize)
+	if _, err := r.ReadAt(sb, 0); err != nil {
+		return nil, errors.New("truncated SquashFS superblock")
+	}
+	if string(sb[:4]) != squashfsMagic {
+		return nil, errors.New("Not a SquashFS image")
+	}
+	le := binary.LittleEndian
+	if major := le.Uint16(sb[28:]); major != 4 {
+		return nil, errors.New("unsupported SquashFS version " + strconv.Itoa(int(major)))
+	}
+	fs := &squashfs{
+		r:              r,
+		size:           size,
+		blockSize:      le.Uint32(sb[12:]),
+		fragmentCount:  le.Uint32(sb[16:]),
+		compressor:     le.Uint16(sb[20:]),
+		rootInode:      le.Uint64(sb[32:]),
+		inodeTable:     int64(le.Uint64(sb[64:])),
+		directoryTable: int64(le.Uint64(sb[72:])),
+		fragmentTable:  int64(le.Uint64(sb[80:])),
+		fragmentCache:  make(map[uint32][]byte),
+	}
+	if fs.blockSize < 4096 || fs.blockSize > 1024*1024 {
+		return nil, errors.New("invalid SquashFS block size")
+	}
+	switch fs.compressor {
+	case squashfsGzip, squashfsXz, squashfsLz4:
+	case squashfsZstd:
+		decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		fs.zstdDecoder = decoder
+	default:
+		return nil, errors.New("unsupported SquashFS compression type " + strconv.Itoa(int(fs.compressor)))
+	}
+	return fs, nil
+}
+
+// close releases the resources used by the decompressor
+func (fs *squashfs) close() {
+	if fs.zstdDecoder != nil {
+		fs.zstdDecoder.Close()
+	}
+}
+
+// decompress decompresses a data or metadata block that is at most maxSize bytes when uncompressed
+func (fs *squashfs) decompress(data []byte, maxSize int) ([]byte, error) {
+	var (
+		out []byte
+		err error
+	)
+	switch fs.compressor {
+	case squashfsGzip:
+		var zr io.ReadCloser
+		if zr, err = zlib.NewReader(bytes.NewReader(data)); err == nil {
+			out, err = io.ReadAll(io.LimitReader(zr, int64(maxSize)+1))
+			zr.Close()
+		}
+	case squashfsXz:
+		var xr *xz.Reader
+		if xr, err = xz.NewReader(bytes.NewReader(data), 0); err == nil {
+			out, err = io.ReadAll(io.LimitReader(xr, int64(maxSize)+1))
+		}
+	case squashfsLz4:
+		out = make([]byte, maxSize)
+		var n int
+		n, err = lz4.UncompressBlock(data, out)
+		out = out[:n]
+	case squashfsZstd:
+		out, err = fs.zstdDecoder.DecodeAll(data, make([]byte, 0, maxSize))
+	}
+	if err != nil {
+		return nil, errors.New("SquashFS: " + err.Error())
+	}
+	if len(out) > maxSize {
+		return nil, errors.New("SquashFS: a block is larger than expected")
+	}
+	return out, nil
+}
+
+// readBlock reads the given number of bytes at the given offset in the image
+func (fs *squashfs) readBlock(offset int64, size uint32) ([]byte, error) {
+	if offset < 0 || offset+int64(size) > fs.size {
+		return nil, errors.New("SquashFS: a block is outside of the image")
+	}
+	data := make([]byte, size)
+	if _, err := fs.r.ReadAt(data, offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// metadataReader reads consecutive bytes from a metadata table, across metadata blocks
+type metadataReader struct {
+	fs   *squashfs
+	next int64 // the position of the next metadata block in the image
+	buf  []byte
+}
+
+// metadata returns a reader for the metadata at the given block position and offset into the uncompressed block
+func (fs *squashfs) metadata(block int64, offset uint16) (*metadataReader, error) {
+	m := &metadataReader{fs: fs, next: block}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	if int(offset) > len(m.buf) {
+		return nil, errors.New("SquashFS: invalid metadata offset")
+	}
+	m.buf = m.buf[offset:]
+	return m, nil
+}
+
+// load reads and decompresses the next metadata block
+func (m *metadataReader) load() error {
+	header, err := m.fs.readBlock(m.next, 2)
+	if err != nil {
+		return err
+	}
+	h := binary.LittleEndian.Uint16(header)
+	size := uint32(h & 0x7fff)
+	data, err := m.fs.readBlock(m.next+2, size)
+	if err != nil {
+		return err
+	}
+	m.next += 2 + int64(size)
+	if h&0x8000 != 0 {
+		m.buf = data
+		return nil
+	}
+	m.buf, err = m.fs.decompress(data, squashfsMetadataSize)
+	return err
+}
+
+// Read reads metadata, continuing with the next metadata block when needed
+func (m *metadataReader) Read(p []byte) (int, error) {
+	for len(m.buf) == 0 {
+		if err := m.load(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, m.buf)
+	m.buf = m.buf[n:]
+	return n, nil
+}
+
+// readInode reads the inode that the given inode reference points to.
+// Only directories and regular files are read in full.
+func (fs *squashfs) readInode(ref uint64) (*squashfsInode, error) {
+	m, err := fs.metadata(fs.inodeTable+int64(ref>>16), uint16(ref&0xffff))
+	if err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(m, header); err != nil {
+		return nil, err
+	}
+	inode := &squashfsInode{kind: le.Uint16(header)}
+	switch inode.kind {
+	case squashfsBasicDir:
+		b := make([]byte, 16)
+		if _, err := io.ReadFull(m, b); err != nil {
+			return nil, err
+		}
+		inode.dirBlock = le.Uint32(b)
+		inode.dirSize = uint32(le.Uint16(b[8:]))
+		inode.dirOffset = le.Uint16(b[10:])
+	case squashfsExtDir:
+		b := make([]byte, 24)
+		if _, err := io.ReadFull(m, b); err != nil {
+			return nil, err
+		}
+		inode.dirSize = le.Uint32(b[4:])
+		inode.dirBlock = le.Uint32(b[8:])
+		inode.dirOffset = le.Uint16(b[18:])
+	case squashfsBasicFile:
+		b := make([]byte, 16)
+		if _, err := io.ReadFull(m, b); err != nil {
+			return nil, err
+		}
+		inode.blocksStart = uint64(le.Uint32(b))
+		inode.fragmentIndex = le.Uint32(b[4:])
+		inode.fragmentOffset = le.Uint32(b[8:])
+		inode.fileSize = uint64(le.Uint32(b[12:]))
+	case squashfsExtFile:
+		b := make([]byte, 40)
+		if _, err := io.ReadFull(m, b); err != nil {
+			return nil, err
+		}
+		inode.blocksStart = le.Uint64(b)
+		inode.fileSize = le.Uint64(b[8:])
+		inode.fragmentIndex = le.Uint32(b[28:])
+		inode.fragmentOffset = le.Uint32(b[32:])
+	default:
+		return inode, nil
+	}
+	if inode.kind == squashfsBasicFile || inode.kind == squashfsExtFile {
+		if inode.fileSize > maxDecompressedSize {
+			return nil, errors.New("SquashFS: a file is too large to be examined")
+		}
+		blockCount := inode.fileSize / uint64(fs.blockSize)
+		if inode.fragmentIndex == squashfsNoFragment && inode.fileSize%uint64(fs.blockSize) != 0 {
+			blockCount++
+		}
+		b := make([]byte, 4*blockCount)
+		if _, err := io.ReadFull(m, b); err != nil {
+			return nil, err
+		}
+		inode.blockSizes = make([]uint32, blockCount)
+		for i := range inode.blockSizes {
+			inode.blockSizes[i] = le.Uint32(b[4*i:])
+		}
+	}
+	return inode, nil
+}
+
+// readDir reads the entries of the given directory inode
+func (fs *squashfs) readDir(inode *squashfsInode) ([]squashfsEntry, error) {
+	// The size includes 3 bytes for the implicit "." and ".." entries
+	if inode.dirSize <= 3 {
+		return nil, nil
+	}
+	m, err := fs.metadata(fs.directoryTable+int64(inode.dirBlock), inode.dirOffset)
+	if err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	var (
+		entries  []squashfsEntry
+		consumed uint32
+		size     = inode.dirSize - 3
+		header   = make([]byte, 12)
+		entry    = make([]byte, 8)
+	)
+	for consumed < size {
+		if _, err := io.ReadFull(m, header); err != nil {
+			return nil, err
+		}
+		consumed += 12
+		count := le.Uint32(header) + 1
+		start := uint64(le.Uint32(header[4:]))
+		if count > 256 {
+			return nil, errors.New("SquashFS: corrupt directory")
+		}
+		for i := uint32(0); i < count; i++ {
+			if _, err := io.ReadFull(m, entry); err != nil {
+				return nil, err
+			}
+			nameSize := uint32(le.Uint16(entry[6:])) + 1
+			name := make([]byte, nameSize)
+			if _, err := io.ReadFull(m, name); err != nil {
+				return nil, err
+			}
+			consumed += 8 + nameSize
+			entries = append(entries, squashfsEntry{
+				name:  string(name),
+				inode: start<<16 | uint64(le.Uint16(entry)),
+			})
+		}
+	}
+	return entries, nil
+}
+
+// fragment reads and decompresses the fragment block with the given index
+func (fs *squashfs) fragment(index uint32) ([]byte, error) {
+	if data, ok := fs.fragmentCache[index]; ok {
+		return data, nil
+	}
+	if index >= fs.fragmentCount {
+		return nil, errors.New("SquashFS: invalid fragment index")
+	}
+	// The fragment table is a list of positions of metadata blocks with 512 entries each
+	pointer, err := fs.readBlock(fs.fragmentTable+8*int64(index/512), 8)
+	if err != nil {
+		return nil, err
+	}
+	m, err := fs.metadata(int64(binary.LittleEndian.Uint64(pointer)), uint16(index%512)*16)
+	if err != nil {
+		return nil, err
+	}
+	entry := make([]byte, 16)
+	if _, err := io.ReadFull(m, entry); err != nil {
+		return nil, err
+	}
+	data, err := fs.dataBlock(int64(binary.LittleEndian.Uint64(entry)), binary.LittleEndian.Uint32(entry[8:]))
+	if err != nil {
+		return nil, err
+	}
+	// Only keep the most recently used fragment block, files are usually read in order
+	delete(fs.fragmentCache, fs.lastFragmentRead)
+	fs.fragmentCache[index] = data
+	fs.lastFragmentRead = index
+	return data, nil
+}
+
+// dataBlock reads a data block, given its position and the size field from the inode or the fragment table
+func (fs *squashfs) dataBlock(offset int64, sizeField uint32) ([]byte, error) {
+	size := sizeField &^ squashfsUncompressed
+	if size == 0 {
+		// Sparse block
+		return make([]byte, fs.blockSize), nil
+	}
+	if size > fs.blockSize {
+		return nil, errors.New("SquashFS: invalid block size")
+	}
+	data, err := fs.readBlock(offset, size)
+	if err != nil {
+		return nil, err
+	}
+	if sizeField&squashfsUncompressed != 0 {
+		return data, nil
+	}
+	return fs.decompress(data, int(fs.blockSize))
+}
+
+// squashfsFile reads the contents of a regular file, one block at a time
+type squashfsFile struct {
+	fs        *squashfs
+	inode     *squashfsInode
+	block     int   // the index of the next block
+	offset    int64 // the position of the next block in the image
+	buf       []byte
+	remaining uint64 // the number of bytes that are left to return
+}
+
+// Read reads the next part of the file
+func (f *squashfsFile) Read(p []byte) (int, error) {
+	for len(f.buf) == 0 {
+		if f.remaining == 0 {
+			return 0, io.EOF
+		}
+		switch {
+		case f.block < len(f.inode.blockSizes):
+			sizeField := f.inode.blockSizes[f.block]
+			data, err := f.fs.dataBlock(f.offset, sizeField)
+			if err != nil {
+				return 0, err
+			}
+			f.buf = data
+			f.offset += int64(sizeField &^ squashfsUncompressed)
+			f.block++
+		case f.inode.fragmentIndex != squashfsNoFragment:
+			data, err := f.fs.fragment(f.inode.fragmentIndex)
+			if err != nil {
+				return 0, err
+			}
+			start := uint64(f.inode.fragmentOffset)
+			if start+f.remaining > uint64(len(data)) {
+				return 0, errors.New("SquashFS: invalid fragment offset")
+			}
+			f.buf = data[start : start+f.remaining]
+		default:
+			return 0, errors.New("SquashFS: file is shorter than expected")
+		}
+		if uint64(len(f.buf)) > f.remaining {
+			f.buf = f.buf[:f.remaining]
+		}
+	}
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	f.remaining -= uint64(n)
+	return n, nil
+}
+
+// walk calls fn for every regular file in the image, with the absolute path,
+// the size and a reader for the contents of the file, until fn returns an error
+func (fs *squashfs) walk(fn func(name string, r io.Reader, size int64) error) error {
+	visited := make(map[uint64]bool)
+	var walkDir func(dir string, ref uint64, depth int) error
+	walkDir = func(dir string, ref uint64, depth int) error {
+		if depth > squashfsMaxDepth || visited[ref] {
+			return errors.New("SquashFS: directory loop or too deeply nested directories")
+		}
+		visited[ref] = true
+		inode, err := fs.readInode(ref)
+		if err != nil {
+			return err
+		}
+		entries, err := fs.readDir(inode)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			name := path.Join(dir, entry.name)
+			child, err := fs.readInode(entry.inode)
+			if err != nil {
+				return err
+			}
+			switch child.kind {
+			case squashfsBasicDir, squashfsExtDir:
+				if err := walkDir(name, entry.inode, depth+1); err != nil {
+					return err
+				}
+			case squashfsBasicFile, squashfsExtFile:
+				f := &squashfsFile{fs: fs, inode: child, offset: int64(child.blocksStart), remaining: child.fileSize}
+				if err := fn(name, f, int64(child.fileSize)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return walkDir("/", fs.rootInode, 0)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testSquashfsBlockSize is the smallest block size, so that files with several blocks are small
+const testSquashfsBlockSize = 4096
+
+// testSquashfs returns a SquashFS image with the given regular files, and the given symlinks,
+// by their absolute paths. Data blocks are compressed with zlib if compress is true,
+// and the metadata is stored uncompressed.
+func testSquashfs(files, symlinks map[string]string, compress bool) []byte {
+	le := binary.LittleEndian
+	var (
+		data   bytes.Buffer // the data blocks, which start right after the superblock
+		inodes bytes.Buffer // the uncompressed inode table
+		dirs   bytes.Buffer // the uncompressed directory table
+		count  uint32
+	)
+	// ref returns the reference to the metadata at the given uncompressed position, where every
+	// metadata block is stored uncompressed with a 2 byte header
+	ref := func(pos int) (uint32, uint16) {
+		return uint32(pos / squashfsMetadataSize * (squashfsMetadataSize + 2)), uint16(pos % squashfsMetadataSize)
+	}
+	writeInode := func(kind uint16, fields ...interface{}) uint64 {
+		count++
+		block, offset := ref(inodes.Len())
+		binary.Write(&inodes, le, []uint16{kind, 0o755, 0, 0})
+		binary.Write(&inodes, le, []uint32{0, count})
+		for _, field := range fields {
+			binary.Write(&inodes, le, field)
+		}
+		return uint64(block)<<16 | uint64(offset)
+	}
+
+	// The directory tree, with the names of the entries in each directory
+	tree := map[string]map[string]bool{"/": {}}
+	for _, names := range []map[string]string{files, symlinks} {
+		for name := range names {
+			for dir := path.Dir(name); ; name, dir = dir, path.Dir(dir) {
+				if tree[dir] == nil {
+					tree[dir] = make(map[string]bool)
+				}
+				tree[dir][path.Base(name)] = true
+				if dir == "/" {
+					break
+				}
+			}
+		}
+	}
+	type entry struct {
+		name string
+		kind uint16
+		ref  uint64
+	}
+	var writeDir func(dir string) uint64
+	writeDir = func(dir string) uint64 {
+		var names []string
+		for name := range tree[dir] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var entries []entry
+		for _, name := range names {
+			full := path.Join(dir, name)
+			switch {
+			case tree[full] != nil:
+				entries = append(entries, entry{name, squashfsBasicDir, writeDir(full)})
+			case symlinks[full] != "":
+				target := symlinks[full]
+				entries = append(entries, entry{name, 3, writeInode(3, uint32(1), uint32(len(target)), []byte(target))})
+			default:
+				contents := files[full]
+				start := squashfsSuperblockSize + data.Len()
+				var sizes []uint32
+				for i := 0; i < len(contents); i += testSquashfsBlockSize {
+					block := []byte(contents[i:min(i+testSquashfsBlockSize, len(contents))])
+					if compress {
+						var buf bytes.Buffer
+						zw := zlib.NewWriter(&buf)
+						zw.Write(block)
+						zw.Close()
+						data.Write(buf.Bytes())
+						sizes = append(sizes, uint32(buf.Len()))
+					} else {
+						data.Write(block)
+						sizes = append(sizes, uint32(len(block))|squashfsUncompressed)
+					}
+				}
+				entries = append(entries, entry{name, squashfsBasicFile, writeInode(squashfsBasicFile, []uint32{uint32(start), squashfsNoFragment, 0, uint32(len(contents))}, sizes)})
+			}
+		}
+		listingStart := dirs.Len()
+		left := 0 // the number of entries that are left for the current header
+		for i, e := range entries {
+			block := uint32(e.ref >> 16)
+			if left == 0 || block != uint32(entries[i-1].ref>>16) {
+				// A header for up to 256 of the following entries with inodes in the same metadata block
+				left = 0
+				for _, next := range entries[i:] {
+					if uint32(next.ref>>16) != block || left == 256 {
+						break
+					}
+					left++
+				}
+				binary.Write(&dirs, le, []uint32{uint32(left - 1), block, 0})
+			}
+			left--
+			binary.Write(&dirs, le, []uint16{uint16(e.ref), 0, e.kind, uint16(len(e.name) - 1)})
+			dirs.WriteString(e.name)
+		}
+		block, offset := ref(listingStart)
+		return writeInode(squashfsBasicDir, []uint32{block, 2}, []uint16{uint16(dirs.Len() - listingStart + 3), offset}, uint32(0))
+	}
+	root := writeDir("/")
+
+	// metadataTable returns the given table as uncompressed metadata blocks
+	metadataTable := func(table []byte) []byte {
+		var buf bytes.Buffer
+		for i := 0; i < len(table); i += squashfsMetadataSize {
+			block := table[i:min(i+squashfsMetadataSize, len(table))]
+			binary.Write(&buf, le, uint16(len(block))|0x8000)
+			buf.Write(block)
+		}
+		return buf.Bytes()
+	}
+	inodeTable := int64(squashfsSuperblockSize + data.Len())
+	inodeBlocks := metadataTable(inodes.Bytes())
+	dirTable := inodeTable + int64(len(inodeBlocks))
+	dirBlocks := metadataTable(dirs.Bytes())
+
+	sb := make([]byte, squashfsSuperblockSize)
+	copy(sb, squashfsMagic)
+	le.PutUint32(sb[4:], count)
+	le.PutUint32(sb[12:], testSquashfsBlockSize)
+	le.PutUint16(sb[20:], squashfsGzip)
+	le.PutUint16(sb[22:], 12)
+	le.PutUint16(sb[28:], 4)
+	le.PutUint64(sb[32:], root)
+	le.PutUint64(sb[40:], uint64(dirTable)+uint64(len(dirBlocks)))
+	le.PutUint64(sb[64:], uint64(inodeTable))
+	le.PutUint64(sb[72:], uint64(dirTable))
+	le.PutUint64(sb[80:], ^uint64(0))
+	image := append(sb, data.Bytes()...)
+	image = append(image, inodeBlocks...)
+	return append(image, dirBlocks...)
+}
+
+func TestExamineSquashfs(t *testing.T) {
+	exe := string(testELF())
+	files := map[string]string{
+		"/usr/bin/a":         exe,
+		"/usr/bin/b":         "not an executable",
+		"/usr/lib/large.so":  exe + strings.Repeat("\x00", 3*testSquashfsBlockSize),
+		"/usr/lib/x.a":       string(testAr(arMagic, "x.o/", exe)),
+		"/opt/empty/nothing": "",
+	}
+	symlinks := map[string]string{"/usr/bin/c": "a"}
+	want := []string{"/usr/bin/a", "/usr/lib/large.so", "/usr/lib/x.a(x.o)"}
+	for _, tc := range []struct {
+		name  string
+		image []byte
+		want  []string
+		err   string
+	}{
+		{"uncompressed", testSquashfs(files, symlinks, false), want, ""},
+		{"compressed", testSquashfs(files, symlinks, true), want, ""},
+		{"many files", testSquashfs(manyTestFiles(600, exe), nil, false), nil, ""},
+		{"empty", testSquashfs(nil, nil, false), nil, ""},
+		{"version 3", patchTestImage(testSquashfs(nil, nil, false), 28, 3), nil, "unsupported SquashFS version 3"},
+		{"invalid block size", patchTestImage(testSquashfs(nil, nil, false), 12, 512), nil, "invalid SquashFS block size"},
+		{"LZO compression", patchTestImage(testSquashfs(nil, nil, false), 20, 3), nil, "unsupported SquashFS compression type 3"},
+		{"truncated superblock", []byte(squashfsMagic), nil, "truncated SquashFS superblock"},
+		{"truncated", testSquashfs(files, nil, false)[:squashfsSuperblockSize+100], nil, "SquashFS: a block is outside of the image"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := examineBytes(&examination{ctx: context.Background()}, tc.image)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("got the error %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := resultNames(results)
+			if tc.name == "many files" {
+				if len(got) != 600 {
+					t.Errorf("got %d results, want 600", len(got))
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// manyTestFiles returns the given number of files with the given contents, in one directory
+func manyTestFiles(n int, contents string) map[string]string {
+	files := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		files["/lib/"+strings.Repeat("x", i%50)+string(rune('a'+i%26))+string(rune('a'+i/26))] = contents
+	}
+	return files
+}
+
+// patchTestImage sets the 16 or 32 bit little endian field at the given offset of the superblock
+func patchTestImage(image []byte, offset int, value uint32) []byte {
+	if offset == 12 {
+		binary.LittleEndian.PutUint32(image[offset:], value)
+	} else {
+		binary.LittleEndian.PutUint16(image[offset:], uint16(value))
+	}
+	return image
+}
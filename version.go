@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// splitVersion splits a version like "1.92.0-nightly" or "1.21rc2" into
+// the numeric components and the pre-release suffix, if any
+func splitVersion(version string) ([]int, string) {
+	var numbers []int
+	for version != "" {
+		end := 0
+		for end < len(version) && version[end] >= '0' && version[end] <= '9' {
+			end++
+		}
+		if end == 0 {
+			break
+		}
+		n, _ := strconv.Atoi(version[:end])
+		numbers = append(numbers, n)
+		version = version[end:]
+		if !strings.HasPrefix(version, ".") {
+			break
+		}
+		version = version[1:]
+	}
+	return numbers, strings.TrimLeft(version, "-+~.")
+}
+
+// compareVersions compares two version numbers, component by component, and returns -1, 0 or 1.
+// Missing components count as zero, so "12" and "12.0.0" are equal. A version with a
+// pre-release suffix, like "1.21rc2" or "1.92.0-nightly", is less than the release.
+func compareVersions(a, b string) int {
+	aNumbers, aSuffix := splitVersion(a)
+	bNumbers, bSuffix := splitVersion(b)
+	for i := 0; i < len(aNumbers) || i < len(bNumbers); i++ {
+		var x, y int
+		if i < len(aNumbers) {
+			x = aNumbers[i]
+		}
+		if i < len(bNumbers) {
+			y = bNumbers[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case aSuffix == bSuffix:
+		return 0
+	case aSuffix == "":
+		return 1
+	case bSuffix == "":
+		return -1
+	case aSuffix < bSuffix:
+		return -1
+	}
+	return 1
+}
+
+// versionConstraint is a single version requirement, like ">= 12" or "< 1.22.5"
+type versionConstraint struct {
+	op      string // one of "<", "<=", ">", ">=", "=", "!=", or "" for a prefix match
+	version string
+}
+
+// parseConstraints parses comma separated version constraints, like ">=1.22.0,<1.22.5".
+// A version without an operator, like "12", matches that version and all versions
+// that start with it, like "12.3.0". An empty string or "*" matches every version.
+func parseConstraints(s string) ([]versionConstraint, error) {
+	var constraints []versionConstraint
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" || field == "*" {
+			continue
+		}
+		var c versionConstraint
+		for _, op := range []string{"<=", ">=", "!=", "==", "<", ">", "="} {
+			if strings.HasPrefix(field, op) {
+				c.op = op
+				if op == "==" {
+					c.op = "="
+				}
+				field = strings.TrimSpace(field[len(op):])
+				break
+			}
+		}
+		if numbers, _ := splitVersion(field); len(numbers) == 0 {
+			return nil, errors.New("invalid version: " + field)
+		}
+		c.version = field
+		constraints = append(constraints, c)
+	}
+	return constraints, nil
+}
+
+// matches checks if the given version satisfies the constraint
+func (c versionConstraint) matches(version string) bool {
+	cmp := compareVersions(version, c.version)
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	}
+	// A prefix match, where "12" matches "12.3.0" but not "120"
+	return version == c.version || strings.HasPrefix(version, c.version+".")
+}
+
+// matchesAll checks if the given version satisfies all of the constraints
+func matchesAll(constraints []versionConstraint, version string) bool {
+	for _, c := range constraints {
+		if !c.matches(version) {
+			return false
+		}
+	}
+	return true
+}
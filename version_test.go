@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"12", "12.0.0", 0},
+		{"1.21.3", "1.21.10", -1},
+		{"13.2.1", "13.2", 1},
+		{"1.21rc2", "1.21", -1},
+		{"1.21rc2", "1.21rc1", 1},
+		{"1.92.0-nightly", "1.92.0", -1},
+		{"1.92.0-beta", "1.92.0-nightly", -1},
+		{"2", "10", -1},
+		{"", "1", -1},
+	} {
+		if got := compareVersions(tc.a, tc.b); got != tc.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+		if got := compareVersions(tc.b, tc.a); got != -tc.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tc.b, tc.a, got, -tc.want)
+		}
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	for _, tc := range []struct {
+		constraints string
+		matching    []string
+		other       []string
+	}{
+		{">=1.22.0,<1.22.5", []string{"1.22", "1.22.4"}, []string{"1.21.9", "1.22.5", "1.23"}},
+		{"12", []string{"12", "12.3.0"}, []string{"120", "1.12", "13"}},
+		{"<= 8", []string{"7.5.0", "8", "8.0"}, []string{"8.1"}},
+		{"> 8", []string{"8.1", "13.2.1"}, []string{"8", "7"}},
+		{"==1.75.0", []string{"1.75", "1.75.0"}, []string{"1.75.1"}},
+		{"!=1.75.0", []string{"1.75.1"}, []string{"1.75.0"}},
+		{"*", []string{"1", "99.9"}, nil},
+		{"", []string{"1"}, nil},
+	} {
+		constraints, err := parseConstraints(tc.constraints)
+		if err != nil {
+			t.Errorf("%q: %v", tc.constraints, err)
+			continue
+		}
+		for _, version := range tc.matching {
+			if !matchesAll(constraints, version) {
+				t.Errorf("%q should match %s", tc.constraints, version)
+			}
+		}
+		for _, version := range tc.other {
+			if matchesAll(constraints, version) {
+				t.Errorf("%q should not match %s", tc.constraints, version)
+			}
+		}
+	}
+	for _, invalid := range []string{">=", "x", ">=1,<y", "~1.2"} {
+		if _, err := parseConstraints(invalid); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}